@@ -1,8 +1,8 @@
 package cruxIPFS
 
 const (
-	// SaveFile file where instances are saved
-	SaveFile = "../save.txt"
+	// SaveFile file where the deployment state is saved
+	SaveFile = "../state.json"
 
 	// DataFolder name of the folder containing data
 	DataFolder = "data"
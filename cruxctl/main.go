@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	cruxIPFS "github.com/dedis/student_19_cruxIPFS"
+	"github.com/dedis/student_19_cruxIPFS/operations"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+const usage = `Usage: cruxctl [flags] <command> [arguments]
+
+Commands:
+  add <node> <file> [reader]  add the file from the node, in the smallest ARA
+                              containing the reader, or the largest ARA of the
+                              node if no reader is given
+  cat <node> <cid>            read the cid from the node, trying its ARAs by
+                              increasing radius
+  pin ls <node>               list the pins of the ARAs of the node
+  pin status <node> <cid>     status of the cid in the ARAs of the node, or
+                              whether it is not pinned
+  peers <node>                list the peers of the ARAs of the node
+  aras [node]                 list the ARAs, or the ARAs of the node
+  route <nodeA> <nodeB>       ARAs used for an interaction between the nodes
+
+Flags:
+`
+
+var state *operations.State
+var router *operations.Router
+var araFlag string
+var policy = operations.DefaultRetryPolicy()
+
+func main() {
+	stateFile := flag.String("state", cruxIPFS.SaveFile,
+		"Deployment state file.")
+	minSize := flag.Int("min", 0, "Ignore the ARAs with fewer members.")
+	flag.StringVar(&araFlag, "ara", "",
+		"Id of the ARA to use instead of the routed one.")
+	flag.DurationVar(&policy.Timeout, "timeout", policy.Timeout,
+		"Deadline of each request to an ARA.")
+	flag.IntVar(&policy.Attempts, "attempts", policy.Attempts,
+		"Attempts of the add and cat requests to an ARA.")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	operations.SetRetryPolicy(policy)
+
+	var err error
+	state, err = operations.ReadState(*stateFile)
+	checkErr(err)
+	router, err = operations.NewRouter(state,
+		operations.LoadOptions{MinSize: *minSize})
+	checkErr(err)
+
+	switch args[0] {
+	case "add":
+		err = add(args[1:])
+	case "cat":
+		err = cat(args[1:])
+	case "pin":
+		err = pin(args[1:])
+	case "peers":
+		err = peers(args[1:])
+	case "aras":
+		err = aras(args[1:])
+	case "route":
+		err = route(args[1:])
+	default:
+		err = errors.New("unknown command " + args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// add adds a file from a node
+func add(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: add <node> <file> [reader]")
+	}
+	node, path := args[0], args[1]
+	var ara *operations.ClusterState
+	if len(args) > 2 {
+		ara = first(router.Route(node, args[2]))
+	} else if candidates := router.ARAs(node); len(candidates) > 0 {
+		ara = candidates[len(candidates)-1]
+	}
+	ara, err := selected(ara, node)
+	if err != nil {
+		return err
+	}
+	cid, err := router.Add(ara.ID, node, path)
+	if err != nil {
+		return err
+	}
+	fmt.Println(cid, "added to ARA", ara.ID, "of", ara.Leader)
+	return nil
+}
+
+// cat writes the content of a cid to stdout
+func cat(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: cat <node> <cid>")
+	}
+	node, cid := args[0], args[1]
+	candidates := router.ARAs(node)
+	if araFlag != "" {
+		ara, err := selected(nil, node)
+		if err != nil {
+			return err
+		}
+		candidates = []*operations.ClusterState{ara}
+	}
+	err := errors.New(node + " is not a member of any ARA")
+	for _, ara := range candidates {
+		var data []byte
+		data, err = router.Cat(ara.ID, node, cid)
+		if err != nil {
+			// fall back on the next ARA
+			fmt.Fprintln(os.Stderr, "ARA", ara.ID, "of", ara.Leader+":", err)
+			continue
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return err
+}
+
+// pin lists the pins or the status of a cid in the ARAs of a node
+func pin(args []string) error {
+	if len(args) < 2 || (args[0] == "status" && len(args) != 3) {
+		return errors.New("usage: pin ls <node> | pin status <node> <cid>")
+	}
+	node := args[1]
+	var ci cid.Cid
+	if args[0] == "status" {
+		var err error
+		if ci, err = cid.Decode(args[2]); err != nil {
+			return err
+		}
+	}
+	return eachARA(node, func(ara *operations.ClusterState) error {
+		c, _ := router.Client(ara.ID, node)
+		ctx, cancel := policy.Context()
+		defer cancel()
+		switch args[0] {
+		case "ls":
+			pins, err := c.Allocations(ctx, api.AllType)
+			if err != nil {
+				return err
+			}
+			for _, p := range pins {
+				fmt.Println(" ", p.Cid, p.Name, len(p.Allocations),
+					"allocations")
+			}
+		case "status":
+			gpi, err := c.Status(ctx, ci, false)
+			if e, ok := err.(*api.Error); ok && e.Code == http.StatusNotFound {
+				return errors.New(args[2] + " is not pinned in this ARA")
+			}
+			if err != nil {
+				return err
+			}
+			pinned := false
+			for _, pi := range gpi.PeerMap {
+				pinned = pinned || pi.Status != api.TrackerStatusUnpinned
+			}
+			if !pinned {
+				return errors.New(args[2] + " is not pinned in this ARA")
+			}
+			for _, pi := range gpi.PeerMap {
+				fmt.Println(" ", pi.PeerName, pi.Status, pi.Error)
+			}
+		default:
+			return errors.New("unknown pin command " + args[0])
+		}
+		return nil
+	})
+}
+
+// peers lists the peers of the ARAs of a node
+func peers(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: peers <node>")
+	}
+	node := args[0]
+	return eachARA(node, func(ara *operations.ClusterState) error {
+		c, _ := router.Client(ara.ID, node)
+		ctx, cancel := policy.Context()
+		defer cancel()
+		ids, err := c.Peers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			fmt.Println(" ", id.Peername, id.ID.Pretty(), id.Error)
+		}
+		return nil
+	})
+}
+
+// aras lists the ARAs of the deployment or of a node
+func aras(args []string) error {
+	if len(args) > 0 {
+		for _, ara := range router.ARAs(args[0]) {
+			printARA(ara)
+		}
+		return nil
+	}
+	for i := range state.Clusters {
+		printARA(&state.Clusters[i])
+	}
+	return nil
+}
+
+// route prints the ARAs used for an interaction between two nodes
+func route(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: route <nodeA> <nodeB>")
+	}
+	r := router.Route(args[0], args[1])
+	if len(r) == 0 {
+		return errors.New("no ARA contains both " + args[0] + " and " +
+			args[1])
+	}
+	for i, ara := range r {
+		if i == 0 {
+			fmt.Print("route:    ")
+		} else {
+			fmt.Print("fallback: ")
+		}
+		printARA(ara)
+	}
+	return nil
+}
+
+// eachARA runs f on the ARAs of the node, or on the ARA given by the -ara flag
+func eachARA(node string, f func(ara *operations.ClusterState) error) error {
+	candidates := router.ARAs(node)
+	if araFlag != "" {
+		ara, err := selected(nil, node)
+		if err != nil {
+			return err
+		}
+		candidates = []*operations.ClusterState{ara}
+	}
+	if len(candidates) == 0 {
+		return errors.New(node + " is not a member of any ARA")
+	}
+	for _, ara := range candidates {
+		fmt.Println("ARA", ara.ID, "of", ara.Leader+":")
+		if err := f(ara); err != nil {
+			fmt.Println("  error:", err)
+		}
+	}
+	return nil
+}
+
+// selected returns the ARA given by the -ara flag if set, the routed ARA
+// otherwise
+func selected(routed *operations.ClusterState, node string) (
+	*operations.ClusterState, error) {
+
+	if araFlag != "" {
+		ara, ok := router.ARA(araFlag)
+		if !ok {
+			return nil, errors.New("unknown ARA " + araFlag)
+		}
+		if _, ok := router.Client(ara.ID, node); !ok {
+			return nil, errors.New(node + " is not a member of ARA " + ara.ID)
+		}
+		return ara, nil
+	}
+	if routed == nil {
+		return nil, errors.New("no ARA found for " + node)
+	}
+	return routed, nil
+}
+
+func first(r []*operations.ClusterState) *operations.ClusterState {
+	if len(r) == 0 {
+		return nil
+	}
+	return r[0]
+}
+
+func printARA(ara *operations.ClusterState) {
+	names := make([]string, 0, len(ara.Members))
+	for _, m := range ara.Members {
+		names = append(names, m.Name)
+	}
+	fmt.Printf("%s leader %s radius %.2f %s %d members: %s\n", ara.ID,
+		ara.Leader, ara.Radius, ara.Consensus, len(names),
+		strings.Join(names, " "))
+}
+
+func checkErr(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -2,6 +2,7 @@ package gentree
 
 import (
 	"math"
+	"strings"
 
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
@@ -55,7 +56,7 @@ func GenARAs(Nodes LocalityNodes, rootNodeName string,
 			}
 		}
 
-		AuxNodes.All[i] = CreateNode(n.Name, n.Level)
+		AuxNodes.All[i] = CreateNode(n.Name, IPlist, n.Level)
 		//AuxNodes.All[i].AvailablePortsStart = n.AvailablePortsStart
 		AuxNodes.All[i].ServerIdentity = n.ServerIdentity
 
@@ -150,9 +151,9 @@ func createBinaryTreeFromGraphTree(GraphTree GraphTree) *onet.Tree {
 	return Tree
 }
 
-// CreateNode with the given parameters
-func CreateNode(Name string, level int) *LocalityNode {
-	//func CreateNode(Name string, IP string, level int) *LocalityNode {
+// CreateNode with the given parameters, IP is a comma separated list of the
+// IP addresses of the node
+func CreateNode(Name string, IP string, level int) *LocalityNode {
 
 	var myNode LocalityNode
 
@@ -163,12 +164,12 @@ func CreateNode(Name string, level int) *LocalityNode {
 	myNode.Name = Name
 	myNode.IP = make(map[string]bool)
 
-	/*
-		tokens := strings.Split(IP, ",")
-		for _, t := range tokens {
+	tokens := strings.Split(IP, ",")
+	for _, t := range tokens {
+		if t = strings.TrimSpace(t); t != "" {
 			myNode.IP[t] = true
 		}
-	*/
+	}
 	myNode.Level = level
 	myNode.ADist = make([]float64, 0)
 	myNode.PDist = make([]string, 0)
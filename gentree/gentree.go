@@ -42,6 +42,18 @@ func (ns LocalityNodes) GetByIP(ip string) *LocalityNode {
 	return nil
 }
 
+// IPs returns the IP addresses of the node, sorted
+func (n *LocalityNode) IPs() []string {
+	ips := make([]string, 0, len(n.IP))
+	for ip, exists := range n.IP {
+		if exists {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
 // GetByServerIdentityIP GetByServerIdentityIP
 func (ns LocalityNodes) GetByServerIdentityIP(ip string) *LocalityNode {
 
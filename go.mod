@@ -6,8 +6,10 @@ require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/coreos/etcd v3.3.18+incompatible // indirect
 	github.com/dedis/cothority_template v0.0.0-20191121084815-f73b5bf67b5d
+	github.com/ipfs/go-cid v0.0.3
 	github.com/ipfs/ipfs-cluster v0.11.0
 	github.com/multiformats/go-multiaddr v0.0.4
+	github.com/multiformats/go-multiaddr-dns v0.0.3
 	github.com/satori/go.uuid v1.2.0
 	go.dedis.ch/cothority/v3 v3.3.2
 	go.dedis.ch/kyber/v3 v3.0.11
@@ -1,7 +1,97 @@
 package operations
 
+import "time"
+
 const (
 	fileFolder      = "files"
 	sequenceName    = "../seq.txt"
 	defaultFileMode = 0777
+	stateFileMode   = 0644
+
+	defaultFileSize       = 2048
+	defaultDedupBlockSize = 256 * 1024 // default chunk size of ipfs
+	defaultDedupPool      = 16
+	dirFanout             = 16 // max number of entries of generated dirs
+	defaultZipfS          = 1.1
+	readBufferSize        = 32 * 1024
+
+	// DefaultReplicationTimeout max time to wait for the replication of a
+	// file in an ARA
+	DefaultReplicationTimeout = 2 * time.Minute
+	replicationPollInterval   = 100 * time.Millisecond
+
+	// DefaultOpTimeout deadline of each attempt of a cluster operation
+	DefaultOpTimeout = time.Minute
+	// DefaultOpAttempts max number of attempts of a cluster operation
+	DefaultOpAttempts   = 3
+	defaultRetryBackoff = time.Second
+
+	// RecordsFile prefix of the csv and jsonl files where the results of the
+	// operations are written
+	RecordsFile = "../records"
+
+	// StateVersion version of the deployment state document
+	StateVersion = 1
+	// DefaultMinARASize ARAs with fewer members are not used by the tests
+	DefaultMinARASize = 3
+)
+
+// size distributions of the generated files
+const (
+	// FixedSize all files have ContentConfig.Size bytes
+	FixedSize = "fixed"
+	// UniformSize sizes uniformly distributed in [MinSize, MaxSize]
+	UniformSize = "uniform"
+	// LogNormalSize log-normal sizes of median Size and parameter Sigma
+	LogNormalSize = "lognormal"
+	// TraceSize sizes drawn from the sizes listed in TraceFile
+	TraceSize = "trace"
+)
+
+// content types of the generated files
+const (
+	// NameContent files repeating their name, highly compressible
+	NameContent = "name"
+	// RandomContent random bytes, no two blocks are the same
+	RandomContent = "random"
+	// DedupContent files made of blocks drawn from a small pool of random
+	// blocks, so that blocks are shared between files
+	DedupContent = "dedup"
+)
+
+// popularity distributions of the objects of a workload
+const (
+	// UniformPopularity all objects are equally popular
+	UniformPopularity = "uniform"
+	// ZipfPopularity the popularity of the objects follows a Zipf law
+	ZipfPopularity = "zipf"
+)
+
+// causes of the failure of an operation
+const (
+	// TimeoutError the operation did not complete before its deadline
+	TimeoutError = "timeout"
+	// NotFoundError unknown node, or cid not found
+	NotFoundError = "not_found"
+	// APIError error returned by IPFS Cluster or IPFS, or connection error
+	APIError = "api"
+	// ContentError the content read does not match the content written
+	ContentError = "content"
+)
+
+// types of records
+const (
+	// WriteRecord record of a write
+	WriteRecord = "write"
+	// ReadRecord record of a read
+	ReadRecord = "read"
+	// GatewayReadRecord record of a read through the http gateway of the
+	// ipfs instance of the reader
+	GatewayReadRecord = "gateway_read"
+	// FirstReplicaRecord time from the start of a write until the file is
+	// pinned on a first peer of the ARA
+	FirstReplicaRecord = "first_replica"
+	// FullReplicationRecord time from the start of a write until the file is
+	// pinned on all the peers of the ARA it is allocated to
+	FullReplicationRecord = "full_replication"
 )
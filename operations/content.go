@@ -0,0 +1,204 @@
+package operations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// DefaultContentConfig returns the configuration of the files written by the
+// tests when nothing else is specified: 2 KiB files repeating their name
+func DefaultContentConfig() ContentConfig {
+	return ContentConfig{
+		SizeDist: FixedSize,
+		Size:     defaultFileSize,
+		Content:  NameContent,
+		Files:    1,
+	}
+}
+
+// NewContentGenerator creates a content generator with the given
+// configuration, the trace file is read if the size distribution is TraceSize
+func NewContentGenerator(cfg ContentConfig) (*ContentGenerator, error) {
+	if cfg.Files < 1 {
+		cfg.Files = 1
+	}
+	if cfg.DedupBlockSize <= 0 {
+		cfg.DedupBlockSize = defaultDedupBlockSize
+	}
+	if cfg.DedupPool <= 0 {
+		cfg.DedupPool = defaultDedupPool
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	g := &ContentGenerator{
+		cfg: cfg,
+		rnd: rand.New(rand.NewSource(cfg.Seed)),
+	}
+
+	switch cfg.SizeDist {
+	case FixedSize, UniformSize, LogNormalSize:
+	case TraceSize:
+		sizes, err := readTrace(cfg.TraceFile)
+		if err != nil {
+			return nil, err
+		}
+		g.trace = sizes
+	default:
+		return nil, errors.New("unknown size distribution " + cfg.SizeDist)
+	}
+
+	switch cfg.Content {
+	case NameContent, RandomContent:
+	case DedupContent:
+		g.pool = make([][]byte, cfg.DedupPool)
+		for i := range g.pool {
+			g.pool[i] = make([]byte, cfg.DedupBlockSize)
+			g.rnd.Read(g.pool[i])
+		}
+	default:
+		return nil, errors.New("unknown content type " + cfg.Content)
+	}
+	return g, nil
+}
+
+// NextSize draws the size of the next file from the size distribution
+func (g *ContentGenerator) NextSize() int64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.nextSize()
+}
+
+// nextSize draws a size, the mutex must be held by the caller
+func (g *ContentGenerator) nextSize() int64 {
+	var size int64
+	switch g.cfg.SizeDist {
+	case UniformSize:
+		size = g.cfg.MinSize
+		if g.cfg.MaxSize > g.cfg.MinSize {
+			size += g.rnd.Int63n(g.cfg.MaxSize - g.cfg.MinSize + 1)
+		}
+	case LogNormalSize:
+		// Size is the median of the distribution
+		mu := math.Log(float64(g.cfg.Size))
+		size = int64(math.Exp(mu + g.cfg.Sigma*g.rnd.NormFloat64()))
+	case TraceSize:
+		size = g.trace[g.rnd.Intn(len(g.trace))]
+	default:
+		size = g.cfg.Size
+	}
+	if size < g.cfg.MinSize {
+		size = g.cfg.MinSize
+	}
+	if g.cfg.MaxSize > 0 && size > g.cfg.MaxSize {
+		size = g.cfg.MaxSize
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// NewFile writes a new file, or a directory tree of cfg.Files files, with the
+// given name in the files folder. It returns the path of the file, the total
+// number of bytes written and, for a single file, the hash of its content.
+func (g *ContentGenerator) NewFile(name string) (*GeneratedFile, error) {
+	if err := os.MkdirAll(fileFolder, defaultFileMode); err != nil {
+		return nil, err
+	}
+	f := &GeneratedFile{Path: filepath.Join(fileFolder, name)}
+	if g.cfg.Files == 1 {
+		data, err := g.writeFile(f.Path, name)
+		f.Size = int64(len(data))
+		h := sha256.Sum256(data)
+		f.Hash = hex.EncodeToString(h[:])
+		return f, err
+	}
+
+	// spread the files over subdirectories of at most fanout entries
+	for i := 0; i < g.cfg.Files; i++ {
+		dir := f.Path
+		for d := i / dirFanout; d > 0; d /= dirFanout {
+			dir = filepath.Join(dir, "d"+strconv.Itoa(d%dirFanout))
+		}
+		if err := os.MkdirAll(dir, defaultFileMode); err != nil {
+			return f, err
+		}
+		data, err := g.writeFile(filepath.Join(dir,
+			"f"+strconv.Itoa(i)), name+strconv.Itoa(i))
+		f.Size += int64(len(data))
+		if err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// writeFile writes a single file and returns its content, seed is the name
+// repeated in NameContent files
+func (g *ContentGenerator) writeFile(path, seed string) ([]byte, error) {
+	g.mutex.Lock()
+	size := g.nextSize()
+	data := make([]byte, size)
+	switch g.cfg.Content {
+	case RandomContent:
+		g.rnd.Read(data)
+	case DedupContent:
+		for off := int64(0); off < size; off += int64(g.cfg.DedupBlockSize) {
+			copy(data[off:], g.pool[g.rnd.Intn(len(g.pool))])
+		}
+	default:
+		copy(data, strings.Repeat(seed, int(size)/len(seed)+1))
+	}
+	g.mutex.Unlock()
+	return data, ioutil.WriteFile(path, data, defaultFileMode)
+}
+
+// AddParams returns the parameters used to add the generated files to IPFS
+// Cluster, with the chunker and raw leaves options of the configuration
+func (g *ContentGenerator) AddParams() *api.AddParams {
+	params := api.DefaultAddParams()
+	if g.cfg.Chunker != "" {
+		params.Chunker = g.cfg.Chunker
+	}
+	params.RawLeaves = g.cfg.RawLeaves
+	if g.cfg.Files > 1 {
+		params.Recursive = true
+	}
+	return params
+}
+
+// readTrace reads a trace of file sizes in bytes, one per line
+func readTrace(filename string) ([]int64, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, 0)
+	for _, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		size, err := strconv.ParseInt(strings.Fields(l)[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		return nil, errors.New("no size in trace " + filename)
+	}
+	return sizes, nil
+}
@@ -0,0 +1,163 @@
+package operations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inTempDir runs f in a temporary working directory, where the files are
+// generated
+func inTempDir(t *testing.T, f func()) {
+	dir, err := ioutil.TempDir("", "cruxipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	f()
+}
+
+func TestContentGeneratorFile(t *testing.T) {
+	inTempDir(t, func() {
+		g, err := NewContentGenerator(DefaultContentConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := g.NewFile("file1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Size != defaultFileSize || int64(len(data)) != f.Size {
+			t.Fatal("wrong size", f.Size, len(data))
+		}
+		if !strings.HasPrefix(string(data), "file1file1") {
+			t.Fatal("the file does not repeat its name")
+		}
+		h := sha256.Sum256(data)
+		if f.Hash != hex.EncodeToString(h[:]) {
+			t.Fatal("wrong hash")
+		}
+	})
+}
+
+func TestContentGeneratorTree(t *testing.T) {
+	inTempDir(t, func() {
+		cfg := DefaultContentConfig()
+		cfg.Files = 2*dirFanout + 1
+		cfg.Content = RandomContent
+		cfg.Size = 100
+		g, err := NewContentGenerator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !g.AddParams().Recursive {
+			t.Fatal("a directory tree is not added recursively")
+		}
+		f, err := g.NewFile("tree")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Hash != "" || f.Size != int64(cfg.Files)*cfg.Size {
+			t.Fatal("wrong tree", f.Size, f.Hash)
+		}
+		files := 0
+		err = filepath.Walk(f.Path, func(p string, info os.FileInfo,
+			err error) error {
+			if err == nil && !info.IsDir() {
+				files++
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files != cfg.Files {
+			t.Fatal(files, "files written instead of", cfg.Files)
+		}
+	})
+}
+
+func TestContentGeneratorSizes(t *testing.T) {
+	cfg := DefaultContentConfig()
+	cfg.SizeDist = UniformSize
+	cfg.MinSize = 10
+	cfg.MaxSize = 20
+	cfg.Seed = 1
+	g, err := NewContentGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if s := g.NextSize(); s < cfg.MinSize || s > cfg.MaxSize {
+			t.Fatal("size", s, "out of bounds")
+		}
+	}
+
+	// log-normal sizes are clamped
+	cfg.SizeDist = LogNormalSize
+	cfg.Size = 15
+	cfg.Sigma = 3
+	g, err = NewContentGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if s := g.NextSize(); s < cfg.MinSize || s > cfg.MaxSize {
+			t.Fatal("size", s, "out of bounds")
+		}
+	}
+
+	// same seed, same sizes
+	g2, err := NewContentGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, _ = NewContentGenerator(cfg)
+	for i := 0; i < 10; i++ {
+		if g.NextSize() != g2.NextSize() {
+			t.Fatal("generators with the same seed draw different sizes")
+		}
+	}
+
+	cfg.SizeDist = "pareto"
+	if _, err := NewContentGenerator(cfg); err == nil {
+		t.Fatal("no error for an unknown size distribution")
+	}
+}
+
+func TestContentGeneratorTrace(t *testing.T) {
+	inTempDir(t, func() {
+		err := ioutil.WriteFile("trace.txt", []byte("5\n7\n\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := DefaultContentConfig()
+		cfg.SizeDist = TraceSize
+		cfg.TraceFile = "trace.txt"
+		g, err := NewContentGenerator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			if s := g.NextSize(); s != 5 && s != 7 {
+				t.Fatal("size", s, "not in the trace")
+			}
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// gatewayClient http client of the gateway reads. Connections are not reused,
+// so that each read measures the connection to the gateway.
+var gatewayClient = &http.Client{
+	Transport: &http.Transport{DisableKeepAlives: true},
+}
+
+// gatewayARAs reads the given cid from the http gateway of the ipfs instance
+// of the given node, in all the ARAs of the node at the same time
+func gatewayARAs(node, cid string, expected *GeneratedFile) ([]araResult,
+	error) {
+
+	return eachARA(node, func(n *Node, i int) araResult {
+		gw := ""
+		if i < len(n.Gateways) {
+			gw = n.Gateways[i]
+		}
+		return catGateway(gw, cid, expected)
+	})
+}
+
+// catGateway reads the cid from the gateway at the given host:port address,
+// with the retry policy
+func catGateway(gw, cid string, expected *GeneratedFile) araResult {
+	if gw == "" {
+		return araResult{Cid: cid, Err: &OpError{Kind: NotFoundError,
+			Err: errors.New("no gateway to read " + cid)}}
+	}
+	return retry.do(func(ctx context.Context) araResult {
+		return readGateway(ctx, gw, cid, expected)
+	})
+}
+
+// readGateway fetches /ipfs/<cid> from the gateway at the given host:port
+// address, as a web client would, streaming the whole content. The time to
+// connect to the gateway, the time to the first byte of the response and the
+// total time are measured.
+func readGateway(ctx context.Context, gw, cid string,
+	expected *GeneratedFile) araResult {
+
+	res := araResult{Cid: cid}
+	var connectStart time.Time
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				res.Connect = time.Since(connectStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			res.TTFB = time.Since(start)
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+gw+"/ipfs/"+cid,
+		nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	resp, err := gatewayClient.Do(req)
+	if err != nil {
+		res.Time = time.Since(start)
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res.Time = time.Since(start)
+		res.Err = gatewayError(resp)
+		return res
+	}
+	stream(resp.Body, start, &res, expected)
+	return res
+}
+
+// gatewayError returns the error of a failed gateway response
+func gatewayError(resp *http.Response) error {
+	err := errors.New("gateway: " + resp.Status)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return &OpError{Kind: NotFoundError, Err: err}
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return &OpError{Kind: TimeoutError, Err: err}
+	}
+	return &OpError{Kind: APIError, Err: err}
+}
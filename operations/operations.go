@@ -3,12 +3,13 @@ package operations
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -19,61 +20,134 @@ import (
 )
 
 var nodes = make(map[string]*Node)
+var content *ContentGenerator
+var retry = DefaultRetryPolicy()
 
-// Read the given filename from the given node
+func init() {
+	var err error
+	content, err = NewContentGenerator(DefaultContentConfig())
+	if err != nil {
+		log.Fatal("invalid default content configuration:", err)
+	}
+}
+
+// Read the given filename from the given node, returns the read time in each
+// ARA where the read succeeded
 func Read(node, filename string) map[string]time.Duration {
-	if len(nodes) == 0 {
-		nodes = LoadClusterInstances(cruxIPFS.SaveFile)
-	}
-	if n, ok := nodes[node]; ok {
-		mutex := &sync.Mutex{}
-		wg := sync.WaitGroup{}
-		wg.Add(len(n.Clients))
-		results := make(map[string]time.Duration)
-
-		for i, c := range n.Clients {
-			go func(c0 client.Client, m *sync.Mutex, i int) {
-				t := readFile(c0, filename)
-				m.Lock()
-				results[n.Secrets[i]] = t
-				m.Unlock()
-				wg.Done()
-			}(c, mutex, i)
-		}
-		wg.Wait()
+	results := make(map[string]time.Duration)
+	res, err := readARAs(node, filename, nil)
+	if err != nil {
+		log.Lvl1(err)
 		return results
 	}
-	panic(node + "do not exist")
+	for _, r := range res {
+		if r.Err != nil {
+			log.Lvl1(r.Err)
+			continue
+		}
+		results[r.ARA] = r.Time
+	}
+	return results
 }
 
-// Write the given filename from the given node
+// Write the given filename from the given node, returns the cid and the write
+// time in each ARA where the write succeeded
 func Write(node, filename string) (string, map[string]time.Duration) {
+	name := ""
+	results := make(map[string]time.Duration)
+	res, err := writeARAs(node, filename)
+	if err != nil {
+		log.Lvl1(err)
+		return name, results
+	}
+	for _, r := range res {
+		if r.Err != nil {
+			log.Lvl1(r.Err)
+			continue
+		}
+		results[r.ARA] = r.Time
+		if name == "" {
+			name = r.Cid
+		}
+	}
+	return name, results
+}
+
+// readARAs reads the given cid from the given node, in all the ARAs of the
+// node at the same time, checking the content against the expected file if
+// not nil
+func readARAs(node, cid string, expected *GeneratedFile) ([]araResult,
+	error) {
+
+	return eachARA(node, func(n *Node, i int) araResult {
+		return cat(n.Clients[i], cid, expected)
+	})
+}
+
+// writeARAs writes the given filename from the given node, in all the ARAs of
+// the node at the same time
+func writeARAs(node, filename string) ([]araResult, error) {
+	return eachARA(node, func(n *Node, i int) araResult {
+		return add(n.Clients[i], filepath.Join(fileFolder, filename),
+			content.AddParams())
+	})
+}
+
+// add writes the file at the given path to the cluster of the client, with
+// the retry policy
+func add(c client.Client, path string, params *api.AddParams) araResult {
+	return retry.do(func(ctx context.Context) araResult {
+		cid, t, err := writeFile(ctx, c, path, params)
+		return araResult{Cid: cid, Time: t, Err: err}
+	})
+}
+
+// cat reads the cid from the cluster of the client, with the retry policy
+func cat(c client.Client, cid string, expected *GeneratedFile) araResult {
+	return retry.do(func(ctx context.Context) araResult {
+		return readFile(ctx, c, cid, expected)
+	})
+}
+
+// eachARA runs f for each ARA i of the node at the same time, and returns the
+// results
+func eachARA(node string, f func(n *Node, i int) araResult) ([]araResult,
+	error) {
+
 	if len(nodes) == 0 {
-		nodes = LoadClusterInstances(cruxIPFS.SaveFile)
-	}
-	if n, ok := nodes[node]; ok {
-		mutex := &sync.Mutex{}
-		wg := sync.WaitGroup{}
-		wg.Add(len(n.Clients))
-		name := ""
-		results := make(map[string]time.Duration)
-
-		for i, c := range n.Clients {
-			go func(c0 client.Client, m *sync.Mutex, i int) {
-				n0, t := writeFile(c0, filepath.Join(fileFolder, filename))
-				m.Lock()
-				results[n.Secrets[i]] = t
-				m.Unlock()
-				if name == "" {
-					name = n0
-				}
-				wg.Done()
-			}(c, mutex, i)
+		if err := loadNodes(); err != nil {
+			return nil, err
 		}
-		wg.Wait()
-		return name, results
 	}
-	panic(node + "do not exist")
+	n, ok := nodes[node]
+	if !ok {
+		return nil, &OpError{Kind: NotFoundError,
+			Err: errors.New(node + " do not exist")}
+	}
+	results := make([]araResult, len(n.Clients))
+	wg := sync.WaitGroup{}
+	wg.Add(len(n.Clients))
+	for i := range n.Clients {
+		go func(i int) {
+			defer wg.Done()
+			results[i] = f(n, i)
+			results[i].ARA = n.ARAs[i]
+			results[i].client = n.Clients[i]
+		}(i)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// loadNodes loads the cluster clients of the ARAs of the saved state
+func loadNodes() error {
+	n, err := LoadClusterInstances(cruxIPFS.SaveFile,
+		LoadOptions{MinSize: DefaultMinARASize})
+	if err != nil {
+		return err
+	}
+	nodes = n
+	return nil
 }
 
 func randomFileName() string {
@@ -82,16 +156,18 @@ func randomFileName() string {
 	return hex.EncodeToString(randBytes)
 }
 
-// NewFile write new file to disk
-func NewFile(filename string) {
-	os.Mkdir(fileFolder, defaultFileMode)
-	// block max size = 256KiB
-	// file size = 2 KiB = 2^11 B
-	// filename length = 32 B = 2^5 * 2 B
-	// repeat filename: 2^11 B / 2^6 B = 2^5 = 32
-	str := strings.Repeat(filename, 32)
-	ioutil.WriteFile(filepath.Join(fileFolder, filename), []byte(str),
-		defaultFileMode)
+// NewFile write new file to disk with the content generator of the tests
+func NewFile(filename string) *GeneratedFile {
+	f, err := content.NewFile(filename)
+	if err != nil {
+		log.Lvl1(err)
+	}
+	return f
+}
+
+// SetContent sets the generator of the files written by the tests
+func SetContent(g *ContentGenerator) {
+	content = g
 }
 
 func checkErr(err error) {
@@ -113,9 +189,13 @@ func printNodes() {
 
 // ListPeers of a client
 func ListPeers(c client.Client) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), retry.Timeout)
+	defer cancel()
 	peers, err := c.Peers(ctx)
-	checkErr(err)
+	if err != nil {
+		log.Error(err)
+		return
+	}
 
 	fmt.Printf("\nPeers in the Cluster:\n")
 	for _, p := range peers {
@@ -123,48 +203,104 @@ func ListPeers(c client.Client) {
 	}
 }
 
-// WriteFile to the cluster
-func writeFile(c client.Client, path string) (string, time.Duration) {
-	ctx := context.Background()
+// writeFile to the cluster, returns the cid of the file
+func writeFile(ctx context.Context, c client.Client, path string,
+	params *api.AddParams) (string, time.Duration, error) {
 
 	_, err := os.Stat(path)
 	if err != nil {
-		log.Lvl1(err)
+		return "", 0, &OpError{Kind: NotFoundError, Err: err}
 	}
-	cids := make(chan string, 10)
+	name := ""
 	out := make(chan *api.AddedOutput, 1)
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go func(ch chan string) {
+	go func() {
 		defer wg.Done()
+		// drain the outputs, the last one is the root of the added file or
+		// directory
 		for v := range out {
-			if v == nil {
-				ch <- ""
-				return
+			if v != nil {
+				name = v.Cid.String()
 			}
-			ch <- v.Cid.String()
 		}
-	}(cids)
+	}()
 
 	paths := []string{path}
 	start := time.Now()
-	c.Add(ctx, paths, api.DefaultAddParams(), out)
+	err = c.Add(ctx, paths, params, out)
 	wg.Wait()
-	name := <-cids
 	t := time.Now()
+	if err != nil {
+		return "", t.Sub(start), err
+	}
 	if name == "" {
-		log.Lvl1("nil return after write")
+		return "", t.Sub(start), errors.New("nil return after write")
 	}
-	return name, t.Sub(start)
+	return name, t.Sub(start), nil
 }
 
-func readFile(c client.Client, filename string) time.Duration {
-	ctx := context.Background()
+// readFile from the ipfs proxy of the cluster, streaming the whole content
+func readFile(ctx context.Context, c client.Client, cid string,
+	expected *GeneratedFile) araResult {
+
+	res := araResult{Cid: cid}
 
+	// same as Cat, but the request is bound to the context
 	sh := c.IPFS(ctx)
 	start := time.Now()
-	_, err := sh.Cat(filename)
-	t := time.Now()
-	checkErr(err)
-	return t.Sub(start)
+	resp, err := sh.Request("cat", cid).Send(ctx)
+	if err == nil && resp.Error != nil {
+		err = resp.Error
+		resp.Close()
+	}
+	if err != nil {
+		res.Time = time.Since(start)
+		res.Err = err
+		return res
+	}
+	defer resp.Output.Close()
+	stream(resp.Output, start, &res, expected)
+	return res
+}
+
+// stream reads the whole content of a read started at start, measuring the
+// time to the first byte (if not measured yet) and the total time. The content
+// is checked against the expected file, if not nil and if it is a single file.
+func stream(r io.Reader, start time.Time, res *araResult,
+	expected *GeneratedFile) {
+
+	h := sha256.New()
+	buf := make([]byte, readBufferSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if res.TTFB == 0 {
+				res.TTFB = time.Since(start)
+			}
+			res.Bytes += int64(n)
+			h.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			res.Time = time.Since(start)
+			res.Err = err
+			return
+		}
+	}
+	res.Time = time.Since(start)
+
+	if expected == nil || expected.Hash == "" {
+		return
+	}
+	if res.Bytes != expected.Size {
+		res.Err = &OpError{Kind: ContentError, Err: fmt.Errorf(
+			"read %d bytes of %s, expected %d", res.Bytes, res.Cid,
+			expected.Size)}
+	} else if hex.EncodeToString(h.Sum(nil)) != expected.Hash {
+		res.Err = &OpError{Kind: ContentError,
+			Err: errors.New("content of " + res.Cid + " does not match")}
+	}
 }
@@ -13,48 +13,6 @@ import (
 	"go.dedis.ch/onet/v3/log"
 )
 
-// Test0 perf test takes random nodes (non reproductible), output max and min
-// time when performing an operation (write + read)
-func Test0(nodesN int) {
-	for i := 0; i < 100; i++ {
-		f := "file" + strconv.Itoa(i) + ".txt"
-
-		r0 := rand.Intn(nodesN)
-		nodeW := service.NodeName + strconv.Itoa(r0)
-		r1 := rand.Intn(nodesN - 1)
-		if r1 >= r0 {
-			r1++
-		}
-		nodeR := service.NodeName + strconv.Itoa(r1)
-
-		//nodeW := "node_0"
-		//nodeR := "node_1"
-		NewFile(f)
-		n, res0 := Write(nodeW, f)
-		res1 := Read(nodeR, n)
-
-		min := time.Duration(math.MaxInt64)
-		max := time.Duration(0)
-		str := "\n"
-		for cluster, t0 := range res0 {
-			if t1, ok := res1[cluster]; ok {
-				sum := t0 + t1
-				//str += fmt.Sprintln("write:", t0, "read:", t1, "total:", sum)
-				if sum < min {
-					min = sum
-				}
-				if sum > max {
-					max = sum
-				}
-			}
-		}
-		id := "optime-" + nodeW + "-" + nodeR
-		str += fmt.Sprintln("min"+id, min.Milliseconds())
-		str += fmt.Sprintln("max"+id, max.Milliseconds())
-		log.Lvl1(str)
-	}
-}
-
 // genSequence generate a random sequence of nOps pairs among nodesN nodes
 func genSequence(nOps, nodesN int) []byte {
 	log.Lvl1("Generating new sequence")
@@ -73,58 +31,9 @@ func genSequence(nOps, nodesN int) []byte {
 	return []byte(str)
 }
 
-// Test1 try to load an existing sequence, if sequence does not match generate a
-// new one. Performance tests, yield min and max operation time (write + read)
-func Test1(nOps, nodesN int) {
-	ops, err := ioutil.ReadFile(sequenceName)
-	if err != nil {
-		ops = genSequence(nOps, nodesN)
-	}
-
-	lines := strings.Split(string(ops), "\n")
-	if len(lines)-1 != nOps {
-		ops = genSequence(nOps, nodesN)
-		lines = strings.Split(string(ops), "\n")
-	}
-	for _, l := range lines {
-		nodes := strings.Split(l, " ")
-		nodeW := nodes[0]
-		nodeR := nodes[1]
-		f := randomFileName()
-		//f := "file" + strconv.Itoa(i) + ".txt"
-
-		NewFile(f)
-		cid, res0 := Write(nodeW, f)
-		res1 := Read(nodeR, cid)
-
-		min := time.Duration(math.MaxInt64)
-		max := time.Duration(0)
-		str := "\n"
-		for cluster, t0 := range res0 {
-			if t1, ok := res1[cluster]; ok {
-				sum := t0 + t1
-				//str += fmt.Sprintln("write:", t0, "read:", t1, "total:", sum)
-				if sum < min {
-					min = sum
-				}
-				if sum > max {
-					max = sum
-				}
-			}
-		}
-		id := "optime-" + nodeW + "-" + nodeR
-		str += fmt.Sprintln("min"+id, min.Milliseconds())
-		str += fmt.Sprintln("max"+id, max.Milliseconds())
-		log.Lvl1(str)
-	}
-}
-
-// Test2 measure nOps write + read operation between pairs of nodes among a set
-// of nodesN nodes. It first tries to read the operation sequence (to reproduce)
-// the same sequence as a previous experiment, if does not exist or invalid
-// format, generate a new sequence
-func Test2(nOps, nodesN int) {
-	log.Lvl1("Starting Test2")
+// loadSequence reads the operation sequence of a previous experiment, if it
+// does not exist or has an invalid format, generates a new sequence
+func loadSequence(nOps, nodesN int) []string {
 	ops, err := ioutil.ReadFile(sequenceName)
 	if err != nil {
 		log.Lvl1("Error in reading operation sequence file")
@@ -147,47 +56,83 @@ func Test2(nOps, nodesN int) {
 			}
 		}
 	}
-	for _, l := range lines[:len(lines)-1] {
-		nodes := strings.Split(l, " ")
-		nodeW := nodes[0]
-		nodeR := nodes[1]
-		f := randomFileName()
+	return lines[:len(lines)-1]
+}
+
+// Test2 measure nOps write + read operation between pairs of nodes among a set
+// of nodesN nodes. It first tries to read the operation sequence (to reproduce)
+// the same sequence as a previous experiment, if does not exist or invalid
+// format, generate a new sequence
+func Test2(nOps, nodesN int) {
+	log.Lvl1("Starting Test2")
+	RunWorkload(Test2Workload(nOps, nodesN))
+}
 
-		NewFile(f)
-		cid, res0 := Write(nodeW, f)
-		res1 := Read(nodeR, cid)
+// Test3 measure nOps write + read operations between pairs of nodes among a
+// set of nodesN nodes, each read being performed only in the smallest ARA
+// containing both nodes, as a Crux client would do
+func Test3(nOps, nodesN int) {
+	log.Lvl1("Starting Test3")
+	cfg := Test2Workload(nOps, nodesN)
+	cfg.Routed = true
+	RunWorkload(cfg)
+}
 
-		min := time.Duration(math.MaxInt64)
-		//time.Sleep(1 * time.Second)
-		max := time.Duration(0)
-		minRead := time.Duration(math.MaxInt64)
-		str := "\n"
-		strread := ""
-		strwrite := ""
-		for cluster, t0 := range res0 {
-			if t1, ok := res1[cluster]; ok {
-				strread += fmt.Sprintf("%d ", t0.Milliseconds())
-				strwrite += fmt.Sprintf("%d ", t1.Milliseconds())
+// RunWorkload runs the workload with the given configuration
+func RunWorkload(cfg WorkloadConfig) {
+	w, err := NewWorkload(cfg)
+	if err != nil {
+		log.Error("Cannot run the workload:", err)
+		return
+	}
+	w.Run()
+}
 
-				sum := t0 + t1
-				if sum < min {
-					min = sum
-				}
-				if sum > max {
-					max = sum
-				}
-				if t1 < minRead {
-					minRead = t1
-				}
+// logInteraction outputs the write + read times of an interaction performed
+// in all ARAs: min and max total time, min read time, and the write and read
+// times in each ARA
+func logInteraction(id string, writes, reads map[string]time.Duration,
+	size int64) {
+
+	min := time.Duration(math.MaxInt64)
+	max := time.Duration(0)
+	minRead := time.Duration(math.MaxInt64)
+	str := "\n"
+	strread := ""
+	strwrite := ""
+	for cluster, t0 := range writes {
+		if t1, ok := reads[cluster]; ok {
+			strread += fmt.Sprintf("%d ", t0.Milliseconds())
+			strwrite += fmt.Sprintf("%d ", t1.Milliseconds())
+
+			sum := t0 + t1
+			if sum < min {
+				min = sum
+			}
+			if sum > max {
+				max = sum
+			}
+			if t1 < minRead {
+				minRead = t1
 			}
 		}
-		id := "optime-" + nodeW + "-" + nodeR
-		str += fmt.Sprintln("min"+id, min.Milliseconds())
-		str += fmt.Sprintln("max"+id, max.Milliseconds())
-		str += fmt.Sprintln("read"+id, minRead.Milliseconds())
-		str += strread + "\n"
-		str += strwrite + "\n"
-
-		log.Lvl1(str)
 	}
+	str += fmt.Sprintln("min"+id, min.Milliseconds())
+	str += fmt.Sprintln("max"+id, max.Milliseconds())
+	str += fmt.Sprintln("read"+id, minRead.Milliseconds())
+	str += strread + "\n"
+	str += strwrite + "\n"
+	str += fmt.Sprintln("size"+id, size)
+
+	log.Lvl1(str)
+}
+
+// logRouted outputs the times of an interaction performed in a single ARA
+func logRouted(id string, op *RoutedOp, size int64) {
+	str := "\n"
+	str += fmt.Sprintln("routed"+id, op.Total().Milliseconds())
+	str += fmt.Sprintln("read"+id, op.Read.Milliseconds())
+	str += fmt.Sprintln("radius"+id, op.Radius)
+	str += fmt.Sprintln("size"+id, size)
+	log.Lvl1(str)
 }
@@ -0,0 +1,147 @@
+package operations
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// recordHeader columns of the records csv file
+var recordHeader = []string{"op", "object", "type", "time", "writer",
+	"reader", "cid", "ara", "radius", "rtt", "latency", "ttfb", "connect",
+	"bytes", "attempts", "cause", "error"}
+
+// NewRecordWriter creates the csv and jsonl record files with the given
+// prefix, e.g. "../records" writes to ../records.csv and ../records.jsonl
+func NewRecordWriter(prefix string) (*RecordWriter, error) {
+	csvFile, err := os.Create(prefix + ".csv")
+	if err != nil {
+		return nil, err
+	}
+	jsonFile, err := os.Create(prefix + ".jsonl")
+	if err != nil {
+		csvFile.Close()
+		return nil, err
+	}
+	w := &RecordWriter{
+		csvFile:  csvFile,
+		jsonFile: jsonFile,
+		csv:      csv.NewWriter(csvFile),
+		json:     json.NewEncoder(jsonFile),
+	}
+	if err := w.csv.Write(recordHeader); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends the record to both files
+func (w *RecordWriter) Write(r Record) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.json.Encode(r); err != nil {
+		return err
+	}
+	return w.csv.Write(r.fields())
+}
+
+// Close flushes and closes the record files
+func (w *RecordWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.csv.Flush()
+	err := w.csv.Error()
+	if e := w.csvFile.Close(); err == nil {
+		err = e
+	}
+	if e := w.jsonFile.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// fields returns the csv fields of the record, in the order of recordHeader
+func (r Record) fields() []string {
+	return []string{
+		strconv.Itoa(r.Op),
+		strconv.Itoa(r.Object),
+		r.Type,
+		strconv.FormatInt(r.Time, 10),
+		r.Writer,
+		r.Reader,
+		r.Cid,
+		r.ARA,
+		strconv.FormatFloat(r.Radius, 'f', -1, 64),
+		strconv.FormatFloat(r.RTT, 'f', -1, 64),
+		strconv.FormatFloat(r.Latency, 'f', -1, 64),
+		strconv.FormatFloat(r.TTFB, 'f', -1, 64),
+		strconv.FormatFloat(r.Connect, 'f', -1, 64),
+		strconv.FormatInt(r.Bytes, 10),
+		strconv.Itoa(r.Attempts),
+		r.Cause,
+		r.Error,
+	}
+}
+
+// newRecord creates the record of the given type of an operation in an ARA
+// started at start
+func newRecord(op *workloadOp, kind string, start time.Time,
+	res araResult) Record {
+
+	r := Record{
+		Op:       op.id,
+		Object:   op.object.id,
+		Type:     kind,
+		Time:     start.UnixNano() / int64(time.Millisecond),
+		Cid:      res.Cid,
+		ARA:      res.ARA,
+		Latency:  milliseconds(res.Time),
+		TTFB:     milliseconds(res.TTFB),
+		Connect:  milliseconds(res.Connect),
+		Attempts: res.Attempts,
+		Cause:    cause(res.Err),
+	}
+	if res.Err != nil {
+		r.Error = res.Err.Error()
+	}
+	return r
+}
+
+// milliseconds returns the duration in ms
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// readPings reads the ping distances (ms) between the nodes, from lines of
+// the form "node_19 node_7 : 321", no distance is known if the file is missing
+func readPings(filename string) map[string]map[string]float64 {
+	pings := make(map[string]map[string]float64)
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Lvl2("No ping distances:", err)
+		return pings
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		tokens := strings.Split(line, " ")
+		if strings.HasPrefix(line, "#") || len(tokens) < 4 {
+			continue
+		}
+		ping, err := strconv.ParseFloat(tokens[3], 64)
+		if err != nil {
+			log.Lvl2("Invalid ping line:", line)
+			continue
+		}
+		if _, ok := pings[tokens[0]]; !ok {
+			pings[tokens[0]] = make(map[string]float64)
+		}
+		pings[tokens[0]][tokens[1]] = ping
+	}
+	return pings
+}
@@ -0,0 +1,97 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/rest/client"
+)
+
+// waitReplication polls the status of the cid in the ARA of the client until
+// it is pinned on all the peers it is allocated to, or until timeout. It
+// returns the times from start to the first pinned replica and to the full
+// replication, -1 if not reached.
+func waitReplication(c client.Client, cidStr string, start time.Time,
+	timeout time.Duration) (time.Duration, time.Duration, error) {
+
+	ci, err := cid.Decode(cidStr)
+	if err != nil {
+		return -1, -1, err
+	}
+	first := time.Duration(-1)
+	deadline := start.Add(timeout)
+	for {
+		allocated, pinned, err := replicas(c, ci)
+		now := time.Since(start)
+		if err == nil && pinned > 0 && first < 0 {
+			first = now
+		}
+		if err == nil && allocated > 0 && pinned == allocated {
+			return first, now, nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = errors.New(cidStr + " pinned on " +
+					strconv.Itoa(pinned) + " of " + strconv.Itoa(allocated) +
+					" peers after " + timeout.String())
+			}
+			return first, -1, err
+		}
+		time.Sleep(replicationPollInterval)
+	}
+}
+
+// replicas returns the number of peers the cid is allocated to, and the
+// number of these peers where it is pinned
+func replicas(c client.Client, ci cid.Cid) (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		replicationPollInterval*10)
+	defer cancel()
+	gpi, err := c.Status(ctx, ci, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	allocated, pinned := 0, 0
+	for _, pi := range gpi.PeerMap {
+		if pi.Status == api.TrackerStatusRemote {
+			// not allocated to this peer
+			continue
+		}
+		allocated++
+		if pi.Status == api.TrackerStatusPinned {
+			pinned++
+		}
+	}
+	return allocated, pinned, nil
+}
+
+// measureReplication measures the replication of the written file in the ARA
+// of the write result, and records the times to the first replica and to the
+// full replication
+func (w *Workload) measureReplication(op *workloadOp, start time.Time,
+	res araResult, size int64) {
+
+	timeout := w.cfg.ReplicationTimeout
+	if timeout <= 0 {
+		timeout = DefaultReplicationTimeout
+	}
+	first, full, err := waitReplication(res.client, res.Cid, start, timeout)
+
+	for _, m := range []struct {
+		kind string
+		t    time.Duration
+	}{{FirstReplicaRecord, first}, {FullReplicationRecord, full}} {
+		r := araResult{ARA: res.ARA, Cid: res.Cid, Time: m.t}
+		if m.t < 0 {
+			r.Err = err
+			if r.Err == nil {
+				r.Err = errors.New("not replicated")
+			}
+		}
+		w.record(op, start, r, op.node, "", size, m.kind)
+	}
+}
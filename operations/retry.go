@@ -0,0 +1,128 @@
+package operations
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// DefaultRetryPolicy returns the policy of the cluster operations when
+// nothing else is specified: 3 attempts of at most 1 minute each
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Timeout:  DefaultOpTimeout,
+		Attempts: DefaultOpAttempts,
+		Backoff:  defaultRetryBackoff,
+	}
+}
+
+// SetRetryPolicy sets the deadline and retries of the cluster operations
+func SetRetryPolicy(p RetryPolicy) {
+	retry = p
+}
+
+// do runs the operation with a deadline for each attempt, and retries it
+// while it fails with a timeout or an API error. The error of the last
+// attempt is returned as an *OpError.
+func (p RetryPolicy) do(op func(ctx context.Context) araResult) araResult {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := p.Backoff
+	var res araResult
+	for i := 1; i <= attempts; i++ {
+		ctx, cancel := p.Context()
+		res = op(ctx)
+		res.Attempts = i
+		if res.Err == nil {
+			cancel()
+			return res
+		}
+		kind := classify(res.Err)
+		if ctx.Err() == context.DeadlineExceeded {
+			kind = TimeoutError
+		}
+		cancel()
+		res.Err = newOpError(kind, i, res.Err)
+		if kind == NotFoundError || kind == ContentError || i == attempts {
+			break
+		}
+		log.Lvl2("Attempt", i, "failed:", res.Err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return res
+}
+
+// Context returns a context bounded by the deadline of one attempt, for the
+// cluster calls that are made only once
+func (p RetryPolicy) Context() (context.Context, context.CancelFunc) {
+	if p.Timeout > 0 {
+		return context.WithTimeout(context.Background(), p.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// newOpError wraps the error of an operation with its cause
+func newOpError(kind string, attempts int, err error) *OpError {
+	if e, ok := err.(*OpError); ok {
+		err = e.Err
+	}
+	return &OpError{Kind: kind, Attempts: attempts, Err: err}
+}
+
+// Error returns the cause and the error of the operation
+func (e *OpError) Error() string {
+	str := e.Kind + " error"
+	if e.Attempts > 1 {
+		str += " after " + strconv.Itoa(e.Attempts) + " attempts"
+	}
+	return str + ": " + e.Err.Error()
+}
+
+// classify returns the cause of the error of an operation
+func classify(err error) string {
+	switch e := err.(type) {
+	case *OpError:
+		return e.Kind
+	case *api.Error:
+		if e.Code == http.StatusNotFound {
+			return NotFoundError
+		}
+	case net.Error:
+		if e.Timeout() {
+			return TimeoutError
+		}
+	}
+	if err == context.DeadlineExceeded {
+		return TimeoutError
+	}
+	// the cluster client and the ipfs shell only keep the message of most
+	// errors
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "deadline exceeded"),
+		strings.Contains(msg, "timeout"):
+		return TimeoutError
+	case strings.Contains(msg, "not found"),
+		strings.Contains(msg, "no link named"),
+		strings.Contains(msg, "do not exist"):
+		return NotFoundError
+	}
+	return APIError
+}
+
+// cause returns the cause of the error of an operation, empty if none
+func cause(err error) string {
+	if err == nil {
+		return ""
+	}
+	return classify(err)
+}
@@ -0,0 +1,80 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+func TestClassify(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		kind string
+	}{
+		{context.DeadlineExceeded, TimeoutError},
+		{&net.DNSError{Err: "i/o timeout", IsTimeout: true}, TimeoutError},
+		{errors.New("Post http://x: net/http: request canceled " +
+			"(Client.Timeout exceeded while awaiting headers)"), TimeoutError},
+		{&api.Error{Code: http.StatusNotFound, Message: "pin not found"},
+			NotFoundError},
+		{errors.New("merkledag: not found"), NotFoundError},
+		{errors.New("no link named \"f1\" under Qm"), NotFoundError},
+		{&api.Error{Code: http.StatusInternalServerError,
+			Message: "cannot allocate"}, APIError},
+		{errors.New("connection refused"), APIError},
+		{&OpError{Kind: ContentError, Err: errors.New("mismatch")},
+			ContentError},
+	} {
+		if kind := classify(c.err); kind != c.kind {
+			t.Fatal(c.err, "classified as", kind, "instead of", c.kind)
+		}
+	}
+	if cause(nil) != "" {
+		t.Fatal("cause of a successful operation")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{Timeout: time.Second, Attempts: 3,
+		Backoff: time.Millisecond}
+
+	// api errors are retried
+	calls := 0
+	res := p.do(func(ctx context.Context) araResult {
+		calls++
+		if calls < 2 {
+			return araResult{Err: errors.New("connection refused")}
+		}
+		return araResult{Cid: "cid"}
+	})
+	if res.Err != nil || res.Attempts != 2 || res.Cid != "cid" {
+		t.Fatal("wrong result", res.Err, res.Attempts)
+	}
+
+	// not found errors are not retried
+	calls = 0
+	res = p.do(func(ctx context.Context) araResult {
+		calls++
+		return araResult{Err: errors.New("merkledag: not found")}
+	})
+	e, ok := res.Err.(*OpError)
+	if !ok || e.Kind != NotFoundError || calls != 1 {
+		t.Fatal("wrong result", res.Err, calls)
+	}
+
+	// each attempt has a deadline
+	p.Timeout = 10 * time.Millisecond
+	res = p.do(func(ctx context.Context) araResult {
+		<-ctx.Done()
+		return araResult{Err: ctx.Err()}
+	})
+	e, ok = res.Err.(*OpError)
+	if !ok || e.Kind != TimeoutError || e.Attempts != p.Attempts {
+		t.Fatal("wrong result", res.Err)
+	}
+}
@@ -0,0 +1,189 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/rest/client"
+)
+
+// NewRouter creates a router over the ARAs of the given state having at least
+// opts.MinSize members
+func NewRouter(st *State, opts LoadOptions) (*Router, error) {
+	r := &Router{
+		aras:     make([]*ClusterState, 0),
+		clients:  make(map[string]map[string]client.Client),
+		gateways: make(map[string]map[string]string),
+	}
+	for i := range st.Clusters {
+		c := &st.Clusters[i]
+		if len(c.Members) < opts.MinSize {
+			continue
+		}
+		clients := make(map[string]client.Client)
+		gateways := make(map[string]string)
+		for _, m := range c.Members {
+			cli, err := m.Client()
+			if err != nil {
+				return nil, err
+			}
+			clients[m.Name] = cli
+			if gw := m.Gateway(); gw != "" {
+				gateways[m.Name] = gw
+			}
+		}
+		r.aras = append(r.aras, c)
+		r.clients[c.ID] = clients
+		r.gateways[c.ID] = gateways
+	}
+	// smallest rings first
+	sort.SliceStable(r.aras, func(a, b int) bool {
+		return r.aras[a].Radius < r.aras[b].Radius
+	})
+	return r, nil
+}
+
+// Route returns the ARAs containing both nodes, by increasing radius. The
+// first one is the ARA that Crux uses for an interaction between the nodes,
+// the following ones are the fallbacks.
+func (r *Router) Route(a, b string) []*ClusterState {
+	route := make([]*ClusterState, 0)
+	for _, c := range r.aras {
+		clients := r.clients[c.ID]
+		if _, ok := clients[a]; !ok {
+			continue
+		}
+		if _, ok := clients[b]; !ok {
+			continue
+		}
+		route = append(route, c)
+	}
+	return route
+}
+
+// ARAs returns the ARAs containing the node, by increasing radius
+func (r *Router) ARAs(node string) []*ClusterState {
+	return r.Route(node, node)
+}
+
+// ARA returns the ARA with the given id
+func (r *Router) ARA(id string) (*ClusterState, bool) {
+	for _, c := range r.aras {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Add adds the file at the given path to the ARA through the cluster instance
+// of the node, and returns its cid
+func (r *Router) Add(ara, node, path string) (string, error) {
+	c, ok := r.Client(ara, node)
+	if !ok {
+		return "", errors.New(node + " is not a member of ARA " + ara)
+	}
+	res := add(c, path, addParams(path))
+	return res.Cid, res.Err
+}
+
+// Write adds the file at the given path from the writer node in the smallest
+// ARA containing the writer and each of the readers, or in the smallest ARA
+// of the writer if there is no reader. If the add fails in an ARA, it is
+// retried in the next ARA of the route. It returns the result of each add.
+func (r *Router) Write(writer string, readers []string,
+	path string) []araResult {
+
+	routes := make([][]*ClusterState, 0)
+	for _, reader := range readers {
+		routes = append(routes, r.Route(writer, reader))
+	}
+	if len(routes) == 0 {
+		routes = append(routes, r.ARAs(writer))
+	}
+
+	res := make([]araResult, 0)
+	written := make(map[string]bool)
+	failed := make(map[string]bool)
+	params := addParams(path)
+	for _, route := range routes {
+		for _, c := range route {
+			if written[c.ID] {
+				break
+			}
+			if failed[c.ID] {
+				continue
+			}
+			cli, _ := r.Client(c.ID, writer)
+			a := add(cli, path, params)
+			a.ARA, a.client = c.ID, cli
+			res = append(res, a)
+			if a.Err == nil {
+				written[c.ID] = true
+				break
+			}
+			failed[c.ID] = true
+		}
+	}
+	return res
+}
+
+// addParams returns the add parameters of the content generator, adding a
+// directory recursively
+func addParams(path string) *api.AddParams {
+	params := content.AddParams()
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		params.Recursive = true
+	}
+	return params
+}
+
+// Cat returns the content of the given cid, read through the ipfs proxy of the
+// cluster instance of the node in the ARA with the deadline and retries of the
+// retry policy
+func (r *Router) Cat(ara, node, cid string) ([]byte, error) {
+	c, ok := r.Client(ara, node)
+	if !ok {
+		return nil, errors.New(node + " is not a member of ARA " + ara)
+	}
+	var data []byte
+	res := retry.do(func(ctx context.Context) araResult {
+		res := araResult{Cid: cid}
+		resp, err := c.IPFS(ctx).Request("cat", cid).Send(ctx)
+		if err == nil && resp.Error != nil {
+			err = resp.Error
+			resp.Close()
+		}
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		defer resp.Close()
+		data, res.Err = ioutil.ReadAll(resp.Output)
+		return res
+	})
+	return data, res.Err
+}
+
+// Client returns the client of the cluster instance of the node in the ARA
+func (r *Router) Client(ara, node string) (client.Client, bool) {
+	c, ok := r.clients[ara][node]
+	return c, ok
+}
+
+// Gateway returns the host:port address of the http gateway of the ipfs
+// instance of the node in the ARA
+func (r *Router) Gateway(ara, node string) (string, bool) {
+	gw, ok := r.gateways[ara][node]
+	return gw, ok
+}
+
+// Total returns the duration of the write and the read
+func (op *RoutedOp) Total() time.Duration {
+	return op.Write + op.Read
+}
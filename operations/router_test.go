@@ -0,0 +1,162 @@
+package operations
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCluster returns an ARA of the given members, whose instances listen on
+// the local host
+func testCluster(id string, radius float64, members ...string) ClusterState {
+	c := ClusterState{ID: id, Leader: members[0], Radius: radius}
+	for i, m := range members {
+		port := 9000 + 10*i
+		c.Members = append(c.Members, MemberState{
+			Name:          m,
+			IP:            "127.0.0.1",
+			RestAPIAddr:   "/ip4/127.0.0.1/tcp/" + strconv.Itoa(port),
+			IPFSProxyAddr: "/ip4/127.0.0.1/tcp/" + strconv.Itoa(port+1),
+		})
+	}
+	return c
+}
+
+func TestRouterRoute(t *testing.T) {
+	st := &State{Clusters: []ClusterState{
+		testCluster("large", 50, "node_0", "node_1", "node_2", "node_3"),
+		testCluster("small", 10, "node_1", "node_0", "node_2"),
+		testCluster("other", 5, "node_3", "node_2", "node_4"),
+		testCluster("tiny", 1, "node_0", "node_1"),
+	}}
+	r, err := NewRouter(st, LoadOptions{MinSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// smallest ring first, ARAs with fewer members are ignored
+	route := r.Route("node_0", "node_2")
+	if len(route) != 2 || route[0].ID != "small" || route[1].ID != "large" {
+		t.Fatal("wrong route", route)
+	}
+	route = r.Route("node_1", "node_0")
+	if len(route) != 2 || route[0].ID != "small" {
+		t.Fatal("wrong route", route)
+	}
+	if route := r.Route("node_0", "node_4"); len(route) != 0 {
+		t.Fatal("route between nodes without a common ARA", route)
+	}
+
+	aras := r.ARAs("node_2")
+	if len(aras) != 3 || aras[0].ID != "other" || aras[2].ID != "large" {
+		t.Fatal("wrong ARAs of node_2", aras)
+	}
+	if _, ok := r.Client("small", "node_3"); ok {
+		t.Fatal("client of a node outside of the ARA")
+	}
+	if _, ok := r.ARA("tiny"); ok {
+		t.Fatal("ARA with fewer members than the minimum")
+	}
+
+	// without minimum size, the smallest ring is used
+	r, err = NewRouter(st, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route := r.Route("node_0", "node_1"); route[0].ID != "tiny" {
+		t.Fatal("wrong route", route)
+	}
+}
+
+// fakeClusterAPI returns a server answering the adds of the cluster REST API,
+// or failing them, and the number of adds it received
+func fakeClusterAPI(fail bool) (*httptest.Server, *int32) {
+	adds := new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		if r.URL.Path != "/add" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(adds, 1)
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"code":500,"message":"cannot allocate"}`))
+			return
+		}
+		w.Write([]byte(`{"name":"f","cid":{"/":"QmYyQSo1c1Ym7orWxLYvCrM2` +
+			`EmxFTANf8wXmmE7DWjhx5N"},"size":4}`))
+	}))
+	return srv, adds
+}
+
+func TestRouterWrite(t *testing.T) {
+	defer SetRetryPolicy(retry)
+	SetRetryPolicy(RetryPolicy{Timeout: time.Second, Attempts: 1})
+
+	dir, err := ioutil.TempDir("", "cruxipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "f")
+	if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writer cannot add in the smallest ARA shared with node_1
+	st := &State{Clusters: []ClusterState{
+		testCluster("large", 50, "node_0", "node_1", "node_2", "node_3"),
+		testCluster("small", 10, "node_0", "node_1", "node_2"),
+		testCluster("other", 5, "node_0", "node_3", "node_4"),
+	}}
+	adds := make(map[string]*int32)
+	for i := range st.Clusters {
+		c := &st.Clusters[i]
+		srv, n := fakeClusterAPI(c.ID == "small")
+		defer srv.Close()
+		c.Members[0].RestAPIAddr = "/ip4/127.0.0.1/tcp/" +
+			srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+		adds[c.ID] = n
+	}
+	r, err := NewRouter(st, LoadOptions{MinSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the write falls back to the next ring, once for both readers
+	res := r.Write("node_0", []string{"node_1", "node_2"}, path)
+	if len(res) != 2 || res[0].ARA != "small" || res[0].Err == nil ||
+		res[1].ARA != "large" || res[1].Err != nil || res[1].Cid == "" {
+		t.Fatal("wrong routed write", res)
+	}
+	if *adds["small"] != 1 || *adds["large"] != 1 || *adds["other"] != 0 {
+		t.Fatal("wrong adds", *adds["small"], *adds["large"],
+			*adds["other"])
+	}
+
+	// only in the smallest ARA shared with the reader
+	res = r.Write("node_0", []string{"node_3"}, path)
+	if len(res) != 1 || res[0].ARA != "other" || res[0].Err != nil {
+		t.Fatal("wrong routed write", res)
+	}
+
+	// without reader, in the smallest ARA of the writer
+	res = r.Write("node_0", nil, path)
+	if len(res) != 1 || res[0].ARA != "other" || res[0].Err != nil {
+		t.Fatal("wrong routed write", res)
+	}
+	if *adds["large"] != 1 || *adds["other"] != 2 {
+		t.Fatal("wrong adds", *adds["large"], *adds["other"])
+	}
+}
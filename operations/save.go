@@ -1,10 +1,14 @@
 package operations
 
 import (
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"sort"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/dedis/student_19_cruxIPFS/service"
 	"github.com/ipfs/ipfs-cluster/api/rest/client"
@@ -13,168 +17,173 @@ import (
 	"go.dedis.ch/onet/v3/log"
 )
 
-// SaveState save ipfs and ipfs-cluster instances state
-func SaveState(filename string, instances map[string]*service.NodeInfo) {
-
-	// identifiers for saving state
-
-	str := ""
-	str += "\n##### IPFS instances #####\n\n"
-
-	ids := []string{"IP", "Swarm Port", "API Port", "Gateway Port",
-		"Cluster number", "Clusters"}
-	ids = alignIds(ids, 2)
-	cids := []string{"Cluster leader", "Secret", "Size", "Hosts"}
-	cids = alignIds(cids, 4)
-	pids := []string{"IP", "RestAPI Port", "IPFS Proxy Port", "Cluster Port"}
-	pids = alignIds(pids, 8)
-
+// NewState builds the deployment state of the given ipfs and ipfs-cluster
+// instances, nodes and clusters are sorted so that the document is stable
+func NewState(instances map[string]*service.NodeInfo) *State {
+	st := &State{
+		Version:  StateVersion,
+		Time:     time.Now(),
+		Nodes:    make([]NodeState, 0, len(instances)),
+		Clusters: make([]ClusterState, 0),
+	}
 	for _, i := range instances {
 		ii := i.IPFS
-		str += ii.Name + ":"
-		str += ids[0] + ii.IP
-		if ii.SwarmPort > 0 {
-			str += ids[1] + strconv.Itoa(ii.SwarmPort)
-			str += ids[2] + strconv.Itoa(ii.APIPort)
-			str += ids[3] + strconv.Itoa(ii.GatewayPort)
-		}
-		str += ids[4] + strconv.Itoa(len(i.Clusters))
-		str += ids[5]
-
+		st.Nodes = append(st.Nodes, NodeState{
+			Name:        ii.Name,
+			IP:          ii.IP,
+			SwarmPort:   ii.SwarmPort,
+			APIPort:     ii.APIPort,
+			GatewayPort: ii.GatewayPort,
+		})
 		for _, c := range i.Clusters {
-			str += cids[0] + c.Leader
-			str += cids[1] + c.Secret
-			str += cids[2] + strconv.Itoa(c.Size)
-			str += cids[3]
+			cs := ClusterState{
+				ID:        SecretRef(c.Secret),
+				Leader:    c.Leader,
+				Radius:    c.Radius,
+				Consensus: c.Profile.Consensus,
+				Members:   make([]MemberState, 0, len(c.Instances)),
+			}
 			for _, ci := range c.Instances {
-				str += "\n      " + ci.HostName
-				str += pids[0] + ci.IP
-				str += pids[1] + strconv.Itoa(ci.RestAPIPort)
-				str += pids[2] + strconv.Itoa(ci.IPFSProxyPort)
-				str += pids[3] + strconv.Itoa(ci.ClusterPort)
-				str += "\n"
+				cs.Members = append(cs.Members, MemberState{
+					Name:          ci.HostName,
+					IP:            ci.IP,
+					PeerID:        ci.PeerID,
+					IPFSAPIAddr:   ci.IPFSAPIAddr,
+					GatewayAddr:   ci.GatewayAddr,
+					RestAPIAddr:   ci.RestAPIAddr,
+					IPFSProxyAddr: ci.IPFSProxyAddr,
+					ClusterAddr:   ci.ClusterAddr,
+				})
 			}
+			sort.Slice(cs.Members, func(a, b int) bool {
+				return cs.Members[a].Name < cs.Members[b].Name
+			})
+			st.Clusters = append(st.Clusters, cs)
 		}
-		str += "\n"
 	}
-	log.Lvl1(str)
-	ioutil.WriteFile(filename, []byte(str), 0)
+	sort.Slice(st.Nodes, func(a, b int) bool {
+		return st.Nodes[a].Name < st.Nodes[b].Name
+	})
+	sort.Slice(st.Clusters, func(a, b int) bool {
+		if st.Clusters[a].Leader != st.Clusters[b].Leader {
+			return st.Clusters[a].Leader < st.Clusters[b].Leader
+		}
+		return st.Clusters[a].Radius < st.Clusters[b].Radius
+	})
+	return st
 }
 
-func alignIds(ids []string, indent int) []string {
-	max := 0
-	for _, t := range ids {
-		if len(t) > max {
-			max = len(t)
-		}
-	}
-	for i, t := range ids {
-		ids[i] = "\n" + strings.Repeat(" ", indent) + t +
-			strings.Repeat(" ", max-len(t)) + " : "
-	}
-	return ids
+// SecretRef returns the reference identifying an ARA in the state, derived
+// from its cluster secret so that the secret itself is not written
+func SecretRef(secret string) string {
+	h := sha256.Sum256([]byte("ara:" + secret))
+	return hex.EncodeToString(h[:8])
 }
 
-// LoadClusterInstances load ipfs-cluster instances for each node
-func LoadClusterInstances(filename string) map[string]*Node {
-	bytes, err := ioutil.ReadFile(filename)
+// SaveState save ipfs and ipfs-cluster instances state
+func SaveState(filename string, instances map[string]*service.NodeInfo) error {
+	st := NewState(instances)
+	log.Lvl1("Saving", len(st.Nodes), "nodes and", len(st.Clusters),
+		"ARAs to", filename)
+	return WriteState(filename, st)
+}
+
+// WriteState writes the state document to the given file
+func WriteState(filename string, st *State) error {
+	b, err := json.MarshalIndent(st, "", "  ")
 	if err != nil {
-		panic(err)
+		return err
 	}
-	str := string(bytes)
-	nodes := make(map[string]*Node)
-	lines := strings.Split(str, "\n")
-	nLines := len(lines)
-	for l := 0; l < nLines; l++ {
-		line := lines[l]
-		// cluster instance described next
-		if strings.Contains(line, service.NodeName) &&
-			!strings.Contains(line, ":") {
-
-			size := 0
-			for m := l; m >= 0; m-- {
-				if strings.Contains(lines[m], "Size") {
-					split := strings.Split(lines[m], " ")
-					size, err = strconv.Atoi(split[len(split)-1])
-					checkErr(err)
-					break
-				}
-			}
-			if size <= 2 {
-				continue
-			}
-
-			secret := ""
-			for m := l; m >= 0; m-- {
-				if strings.Contains(lines[m], "Secret") {
-					split := strings.Split(lines[m], " ")
-					secret = split[len(split)-1]
-					checkErr(err)
-					break
-				}
-			}
-			if secret == "" {
-				panic("secret not found")
-			}
+	return ioutil.WriteFile(filename, b, stateFileMode)
+}
 
-			split := strings.Split(line, " ")
-			name := split[len(split)-1]
+// ReadState reads the state document from the given file
+func ReadState(filename string) (*State, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	st := &State{}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, err
+	}
+	if st.Version != StateVersion {
+		return nil, errors.New(filename + ": unsupported state version " +
+			strconv.Itoa(st.Version))
+	}
+	return st, nil
+}
 
-			split = strings.Split(lines[l+1], " ")
-			ip := split[len(split)-1]
+// LoadClusterInstances load ipfs-cluster instances for each node
+func LoadClusterInstances(filename string, opts LoadOptions) (
+	map[string]*Node, error) {
 
-			split = strings.Split(lines[l+2], " ")
-			api := ip + split[len(split)-1]
-			apiAddr, err := ma.NewMultiaddr(api)
-			if err != nil {
-				panic(err)
-			}
-			split = strings.Split(lines[l+3], " ")
-			proxy := ip + split[len(split)-1]
-			proxyAddr, err := ma.NewMultiaddr(proxy)
-			if err != nil {
-				panic(err)
-			}
+	st, err := ReadState(filename)
+	if err != nil {
+		return nil, err
+	}
+	return st.ClusterClients(opts)
+}
 
-			conf := client.Config{
-				APIAddr:   apiAddr,
-				ProxyAddr: proxyAddr,
-			}
-			c, err := client.NewDefaultClient(&conf)
+// ClusterClients creates a cluster client for each member of the ARAs of the
+// state, grouped by node
+func (st *State) ClusterClients(opts LoadOptions) (map[string]*Node, error) {
+	nodes := make(map[string]*Node)
+	for _, c := range st.Clusters {
+		if len(c.Members) < opts.MinSize {
+			continue
+		}
+		for _, m := range c.Members {
+			cli, err := m.Client()
 			if err != nil {
-				panic(err)
+				return nil, err
 			}
-
-			if _, ok := nodes[name]; ok {
-				nodes[name].Clients = append(nodes[name].Clients, c)
-				nodes[name].Secrets = append(nodes[name].Secrets, secret)
-				nodes[name].Addrs =
-					append(nodes[name].Addrs, apiAddr.String())
-			} else {
-				// node don't exist, create it and append address
-				cli := make([]client.Client, 1)
-				cli[0] = c
-				secrets := make([]string, 1)
-				secrets[0] = secret
-				addrs := make([]string, 1)
-				addrs[0] = apiAddr.String()
-				nodes[name] = &Node{
-					Name:    name,
-					Clients: cli,
-					Secrets: secrets,
-					Addrs:   addrs,
+			n, ok := nodes[m.Name]
+			if !ok {
+				n = &Node{
+					Name:     m.Name,
+					Clients:  make([]client.Client, 0),
+					ARAs:     make([]string, 0),
+					Addrs:    make([]string, 0),
+					Gateways: make([]string, 0),
 				}
-
+				nodes[m.Name] = n
 			}
+			n.Clients = append(n.Clients, cli)
+			n.ARAs = append(n.ARAs, c.ID)
+			n.Addrs = append(n.Addrs, m.RestAPIAddr)
+			n.Gateways = append(n.Gateways, m.Gateway())
 		}
 	}
-	for _, n := range nodes {
-		if len(n.Clients) != len(n.Secrets) {
-			fmt.Println("Error:")
-			fmt.Println(len(n.Clients), "clients")
-			fmt.Println(len(n.Secrets), "secrets")
-			fmt.Println(len(n.Addrs), "addrs")
-		}
+	return nodes, nil
+}
+
+// Gateway returns the host:port address of the http gateway of the ipfs
+// instance of the member, empty if unknown
+func (m *MemberState) Gateway() string {
+	if m.GatewayAddr == "" {
+		return ""
+	}
+	addr, err := service.HTTPAddr(m.GatewayAddr)
+	if err != nil {
+		log.Lvl2("Invalid gateway address of", m.Name+":", err)
+		return ""
+	}
+	return addr
+}
+
+// Client creates a client for the REST API of the cluster instance
+func (m *MemberState) Client() (client.Client, error) {
+	apiAddr, err := ma.NewMultiaddr(m.RestAPIAddr)
+	if err != nil {
+		return nil, err
+	}
+	proxyAddr, err := ma.NewMultiaddr(m.IPFSProxyAddr)
+	if err != nil {
+		return nil, err
 	}
-	return nodes
+	return client.NewDefaultClient(&client.Config{
+		APIAddr:   apiAddr,
+		ProxyAddr: proxyAddr,
+	})
 }
@@ -1,13 +1,260 @@
 package operations
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/ipfs/ipfs-cluster/api/rest/client"
 )
 
 // Node with its ipfs cluster ac
 type Node struct {
-	Name    string
-	Clients []client.Client
-	Secrets []string
-	Addrs   []string
+	Name     string
+	Clients  []client.Client
+	ARAs     []string // id of the ARA of each client
+	Addrs    []string
+	Gateways []string // host:port of the ipfs gateway in each ARA, if known
+}
+
+// araResult result of an operation in an ARA
+type araResult struct {
+	ARA      string
+	Cid      string
+	Time     time.Duration
+	TTFB     time.Duration // time to the first byte of a read
+	Connect  time.Duration // time to connect to the gateway
+	Bytes    int64         // bytes read
+	Attempts int           // number of attempts of the operation
+	Err      error
+	client   client.Client // client of the node in the ARA
+}
+
+// RetryPolicy deadline and retries of the cluster operations
+type RetryPolicy struct {
+	Timeout  time.Duration // deadline of each attempt, none if 0
+	Attempts int           // max number of attempts
+	Backoff  time.Duration // wait before the second attempt, then doubled
+}
+
+// OpError error of a cluster operation, with its cause
+type OpError struct {
+	Kind     string // TimeoutError, NotFoundError, APIError or ContentError
+	Attempts int
+	Err      error
+}
+
+// State deployment state document, describing the running IPFS and IPFS
+// Cluster instances
+type State struct {
+	Version  int
+	Time     time.Time
+	Nodes    []NodeState
+	Clusters []ClusterState
+}
+
+// NodeState IPFS instance of a node
+type NodeState struct {
+	Name        string
+	IP          string
+	SwarmPort   int `json:",omitempty"`
+	APIPort     int `json:",omitempty"`
+	GatewayPort int `json:",omitempty"`
+}
+
+// ClusterState ARA and its IPFS Cluster instances
+type ClusterState struct {
+	ID        string  // reference to the cluster secret, not the secret
+	Leader    string  // name of the node rooting the ARA
+	Radius    float64 // radius of the ring of the ARA, in ms
+	Consensus string
+	Members   []MemberState
+}
+
+// MemberState IPFS Cluster instance of a member of an ARA
+type MemberState struct {
+	Name          string
+	IP            string
+	PeerID        string `json:",omitempty"`
+	IPFSAPIAddr   string `json:",omitempty"`
+	GatewayAddr   string `json:",omitempty"` // gateway of the ipfs instance
+	RestAPIAddr   string
+	IPFSProxyAddr string
+	ClusterAddr   string
+}
+
+// LoadOptions filters applied when loading the cluster clients from a state
+type LoadOptions struct {
+	// MinSize ARAs with fewer members are skipped
+	MinSize int
+}
+
+// Router routes the interactions between two nodes to the smallest ARA
+// containing both of them
+type Router struct {
+	aras     []*ClusterState                     // by increasing radius
+	clients  map[string]map[string]client.Client // ARA id -> node -> client
+	gateways map[string]map[string]string        // ARA id -> node -> gateway
+}
+
+// RoutedOp write and read performed in a single ARA
+type RoutedOp struct {
+	ARA    string // id of the ARA
+	Leader string
+	Radius float64
+	Cid    string
+	Write  time.Duration
+	Read   time.Duration
+}
+
+// ContentConfig configuration of the files written by the tests
+type ContentConfig struct {
+	SizeDist  string // FixedSize, UniformSize, LogNormalSize or TraceSize
+	Size      int64  // size of fixed files, median of log-normal sizes
+	MinSize   int64  // bounds of uniform sizes, clamp the other ones
+	MaxSize   int64  // no upper bound if 0 (except for uniform sizes)
+	Sigma     float64
+	TraceFile string // file sizes in bytes, one per line
+
+	Content        string // NameContent, RandomContent or DedupContent
+	DedupBlockSize int    // size of the blocks of DedupContent files
+	DedupPool      int    // number of distinct blocks of DedupContent files
+
+	// Files number of files of each write, more than one writes a directory
+	// tree
+	Files int
+
+	// add options passed to IPFS Cluster
+	Chunker   string // e.g. "size-262144" or "rabin", ipfs default if empty
+	RawLeaves bool
+
+	Seed int64 // seed of the generator, random if 0
+}
+
+// GeneratedFile file or directory tree written by a ContentGenerator
+type GeneratedFile struct {
+	Path string
+	Size int64  // total number of bytes of the files
+	Hash string // hex sha256 of the content of a single file, empty for trees
+}
+
+// ContentGenerator generates the files written by the tests
+type ContentGenerator struct {
+	cfg   ContentConfig
+	rnd   *rand.Rand
+	trace []int64  // sizes of TraceSize
+	pool  [][]byte // blocks of DedupContent
+	mutex sync.Mutex
+}
+
+// WorkloadConfig parameters of a workload
+type WorkloadConfig struct {
+	Nodes      int     // number of nodes, node_0 to node_{Nodes-1}
+	Ops        int     // number of operations
+	Objects    int     // number of distinct objects
+	Popularity string  // UniformPopularity or ZipfPopularity
+	ZipfS      float64 // exponent of the Zipf popularity, must be > 1
+	ReadRatio  float64 // fraction of the operations being reads
+	Readers    int     // number of nodes reading the object in a read
+
+	// Rate arrival rate of the operations (per second), following a Poisson
+	// process (open loop). If 0, each operation is issued as soon as a client
+	// of its node is available (closed loop).
+	Rate float64
+	// Clients number of operations that a node runs at the same time, no
+	// limit in open loop if 0. In closed loop, 0 runs all the operations
+	// sequentially.
+	Clients int
+
+	// Routed writes and reads only in the smallest ARA containing the writer
+	// and the reader, instead of in all ARAs
+	Routed bool
+	// Gateway reads through the http gateway of the ipfs instance of the
+	// reader, as a web client would, instead of the ipfs proxy of the cluster
+	Gateway bool
+	// Sequence writes and reads a new object for each pair of nodes of the
+	// operation sequence (Test2), ignoring the other parameters
+	Sequence bool
+
+	Seed int64 // seed of the workload, random if 0
+	// Replication measures, after each write, the time until the file is
+	// pinned on a first and on all the peers of the ARA it is allocated to
+	Replication bool
+	// ReplicationTimeout max time to wait for the replication of a file
+	ReplicationTimeout time.Duration
+
+	// Records prefix of the csv and jsonl files where a record of each
+	// operation is written, no record if empty
+	Records string
+}
+
+// Workload generates and runs operations on the ARAs
+type Workload struct {
+	cfg     WorkloadConfig
+	rnd     *rand.Rand
+	zipf    *rand.Zipf
+	router  *Router
+	objects []*workloadObject
+	slots   map[string]chan bool     // node name -> clients in use
+	aras    map[string]*ClusterState // ARA id -> ARA
+	pings   map[string]map[string]float64
+	records *RecordWriter
+	pending sync.WaitGroup // replication measures in progress
+}
+
+// workloadOp write or read operation of a workload
+type workloadOp struct {
+	id      int
+	write   bool
+	object  *workloadObject
+	node    string        // writer
+	readers []string      // readers of a read, of the version of a write
+	at      time.Duration // arrival time, in open loop
+}
+
+// workloadObject object written and read by a workload
+type workloadObject struct {
+	id         int
+	lastWriter string      // last writer scheduled
+	lastWrite  *workloadOp // last write scheduled
+	written    chan bool   // closed after the first write
+	once       sync.Once
+	mutex      sync.Mutex
+	cid        string
+	writer     string
+	file       *GeneratedFile
+	writes     map[string]time.Duration // ARA id -> write time
+}
+
+// Record result of an operation in an ARA, written to the record files
+type Record struct {
+	Op       int     `json:"op"`     // id of the operation in the workload
+	Object   int     `json:"object"` // id of the object written or read
+	Type     string  `json:"type"`   // WriteRecord or ReadRecord
+	Time     int64   `json:"time"`   // start of the operation, unix ms
+	Writer   string  `json:"writer"`
+	Reader   string  `json:"reader,omitempty"`
+	Cid      string  `json:"cid,omitempty"`
+	ARA      string  `json:"ara"`               // id of the ARA
+	Radius   float64 `json:"radius"`            // radius of the ARA, ms
+	RTT      float64 `json:"rtt"`               // ping distance writer-reader, ms
+	Latency  float64 `json:"latency"`           // total time, ms
+	TTFB     float64 `json:"ttfb,omitempty"`    // time to first byte, ms
+	Connect  float64 `json:"connect,omitempty"` // gateway connection, ms
+	Bytes    int64   `json:"bytes"`
+	Attempts int     `json:"attempts,omitempty"`
+	Cause    string  `json:"cause,omitempty"` // TimeoutError, NotFoundError...
+	Error    string  `json:"error,omitempty"`
+}
+
+// RecordWriter writes records to a csv and a jsonl file
+type RecordWriter struct {
+	csvFile  *os.File
+	jsonFile *os.File
+	csv      *csv.Writer
+	json     *json.Encoder
+	mutex    sync.Mutex
 }
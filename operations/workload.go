@@ -0,0 +1,456 @@
+package operations
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cruxIPFS "github.com/dedis/student_19_cruxIPFS"
+	"github.com/dedis/student_19_cruxIPFS/service"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// DefaultWorkloadConfig returns a closed-loop workload of nOps operations
+// among nodesN nodes, half writes and half reads of uniformly popular objects
+func DefaultWorkloadConfig(nOps, nodesN int) WorkloadConfig {
+	return WorkloadConfig{
+		Nodes:      nodesN,
+		Ops:        nOps,
+		Objects:    nOps,
+		Popularity: UniformPopularity,
+		ReadRatio:  0.5,
+		Readers:    1,
+		Clients:    1,
+		Records:    RecordsFile,
+	}
+}
+
+// Test2Workload returns the workload of Test2: nOps sequential write + read
+// interactions between the pairs of nodes of the operation sequence
+func Test2Workload(nOps, nodesN int) WorkloadConfig {
+	return WorkloadConfig{
+		Nodes:    nodesN,
+		Ops:      nOps,
+		Readers:  1,
+		Sequence: true,
+		Records:  RecordsFile,
+	}
+}
+
+// NewWorkload creates a workload with the given configuration, loading the
+// cluster clients from the saved state
+func NewWorkload(cfg WorkloadConfig) (*Workload, error) {
+	if cfg.Nodes < 2 {
+		return nil, errors.New("a workload needs at least 2 nodes")
+	}
+	if cfg.Readers < 1 {
+		cfg.Readers = 1
+	}
+	if cfg.Readers > cfg.Nodes-1 {
+		cfg.Readers = cfg.Nodes - 1
+	}
+	if cfg.Objects < 1 {
+		cfg.Objects = 1
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	w := &Workload{
+		cfg:     cfg,
+		rnd:     rand.New(rand.NewSource(cfg.Seed)),
+		objects: make([]*workloadObject, 0),
+		slots:   make(map[string]chan bool),
+		aras:    make(map[string]*ClusterState),
+		pings:   readPings(service.PingsFile),
+	}
+
+	switch cfg.Popularity {
+	case "", UniformPopularity:
+	case ZipfPopularity:
+		if w.cfg.ZipfS <= 1 {
+			w.cfg.ZipfS = defaultZipfS
+		}
+		w.zipf = rand.NewZipf(w.rnd, w.cfg.ZipfS, 1, uint64(cfg.Objects-1))
+	default:
+		return nil, errors.New("unknown popularity " + cfg.Popularity)
+	}
+
+	for i := 0; i < cfg.Nodes; i++ {
+		if cfg.Clients > 0 {
+			w.slots[service.NodeName+strconv.Itoa(i)] =
+				make(chan bool, cfg.Clients)
+		}
+	}
+
+	// load the clients before running operations concurrently
+	if len(nodes) == 0 {
+		if err := loadNodes(); err != nil {
+			return nil, err
+		}
+	}
+	st, err := ReadState(cruxIPFS.SaveFile)
+	if err != nil {
+		return nil, err
+	}
+	for i := range st.Clusters {
+		w.aras[st.Clusters[i].ID] = &st.Clusters[i]
+	}
+	if cfg.Routed {
+		w.router, err = NewRouter(st, LoadOptions{MinSize: DefaultMinARASize})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Records != "" {
+		w.records, err = NewRecordWriter(cfg.Records)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Run generates the operations of the workload and runs them. Without
+// arrival rate, the operations are run as fast as the clients of the nodes
+// allow (closed loop), otherwise they are issued at Poisson arrival times
+// whether or not the previous ones are done (open loop).
+func (w *Workload) Run() {
+	ops := w.schedule()
+	log.Lvl1("Running", len(ops), "operations")
+
+	sequential := w.cfg.Rate <= 0 && w.cfg.Clients <= 0
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for _, op := range ops {
+		if sequential {
+			w.execute(op)
+			continue
+		}
+		if w.cfg.Rate > 0 {
+			time.Sleep(time.Until(start.Add(op.at)))
+		}
+		wg.Add(1)
+		go func(op *workloadOp) {
+			defer wg.Done()
+			w.execute(op)
+		}(op)
+	}
+	wg.Wait()
+	w.pending.Wait()
+	log.Lvl1("Workload done in", time.Since(start))
+	if w.records != nil {
+		if err := w.records.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// schedule generates the operations of the workload
+func (w *Workload) schedule() []*workloadOp {
+	if w.cfg.Sequence {
+		return w.sequenceOps()
+	}
+	ops := make([]*workloadOp, 0, w.cfg.Ops)
+	at := time.Duration(0)
+	for i := 0; i < w.cfg.Ops; i++ {
+		if w.cfg.Rate > 0 {
+			// exponential inter-arrival times
+			at += time.Duration(w.rnd.ExpFloat64() / w.cfg.Rate *
+				float64(time.Second))
+		}
+		op := &workloadOp{id: i, at: at}
+		if len(w.objects) == 0 || w.rnd.Float64() >= w.cfg.ReadRatio {
+			op.write = true
+			op.node = w.randomNode(nil)
+			if len(w.objects) < w.cfg.Objects {
+				op.object = w.newObject()
+			} else {
+				op.object = w.popular()
+			}
+			op.object.lastWriter = op.node
+			op.object.lastWrite = op
+		} else {
+			op.object = w.popular()
+			exclude := []string{op.object.lastWriter}
+			for r := 0; r < w.cfg.Readers; r++ {
+				reader := w.randomNode(exclude)
+				exclude = append(exclude, reader)
+				op.readers = append(op.readers, reader)
+			}
+			// a routed write goes to the ARAs shared with the readers
+			write := op.object.lastWrite
+			write.readers = append(write.readers, op.readers...)
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// sequenceOps generates a write of a new object followed by its read for each
+// pair of nodes of the operation sequence
+func (w *Workload) sequenceOps() []*workloadOp {
+	ops := make([]*workloadOp, 0)
+	for _, l := range loadSequence(w.cfg.Ops, w.cfg.Nodes) {
+		pair := strings.Split(l, " ")
+		obj := w.newObject()
+		ops = append(ops, &workloadOp{id: len(ops), write: true,
+			object: obj, node: pair[0], readers: []string{pair[1]}})
+		ops = append(ops, &workloadOp{id: len(ops), object: obj,
+			readers: []string{pair[1]}})
+	}
+	return ops
+}
+
+// newObject creates a new object, not written yet
+func (w *Workload) newObject() *workloadObject {
+	obj := &workloadObject{
+		id:      len(w.objects),
+		written: make(chan bool),
+	}
+	w.objects = append(w.objects, obj)
+	return obj
+}
+
+// popular draws an object according to the popularity distribution, among
+// the objects created so far. Ranks of objects that are not created yet are
+// drawn again, so that the most popular objects are the first ones.
+func (w *Workload) popular() *workloadObject {
+	if w.zipf == nil {
+		return w.objects[w.rnd.Intn(len(w.objects))]
+	}
+	rank := w.zipf.Uint64()
+	for rank >= uint64(len(w.objects)) {
+		rank = w.zipf.Uint64()
+	}
+	return w.objects[rank]
+}
+
+// randomNode draws a node uniformly, among the nodes not excluded
+func (w *Workload) randomNode(exclude []string) string {
+	for {
+		n := service.NodeName + strconv.Itoa(w.rnd.Intn(w.cfg.Nodes))
+		excluded := false
+		for _, e := range exclude {
+			excluded = excluded || e == n
+		}
+		if !excluded {
+			return n
+		}
+	}
+}
+
+// acquire takes a client of the node, if the number of clients is limited
+func (w *Workload) acquire(node string) {
+	if slots, ok := w.slots[node]; ok {
+		slots <- true
+	}
+}
+
+// release frees a client of the node
+func (w *Workload) release(node string) {
+	if slots, ok := w.slots[node]; ok {
+		<-slots
+	}
+}
+
+// execute runs a write or a read operation
+func (w *Workload) execute(op *workloadOp) {
+	if op.write {
+		w.write(op)
+		return
+	}
+	wg := sync.WaitGroup{}
+	for _, reader := range op.readers {
+		wg.Add(1)
+		go func(reader string) {
+			defer wg.Done()
+			w.read(op, reader)
+		}(reader)
+	}
+	wg.Wait()
+}
+
+// write writes a new version of the object from the writer node, in all the
+// ARAs of the node or only in the ARAs chosen by the router for its readers
+func (w *Workload) write(op *workloadOp) {
+	f := randomFileName()
+	file := NewFile(f)
+	size := int64(0)
+	if file != nil {
+		size = file.Size
+	}
+
+	w.acquire(op.node)
+	start := time.Now()
+	var res []araResult
+	var err error
+	if w.cfg.Routed {
+		res = w.router.Write(op.node, op.readers,
+			filepath.Join(fileFolder, f))
+	} else {
+		res, err = writeARAs(op.node, f)
+	}
+	w.release(op.node)
+	if err != nil {
+		res = []araResult{{Err: err}}
+	}
+
+	cid := ""
+	times := make(map[string]time.Duration)
+	for _, r := range res {
+		w.record(op, start, r, op.node, "", size, WriteRecord)
+		if r.Err != nil {
+			log.Lvl1(r.Err)
+			continue
+		}
+		times[r.ARA] = r.Time
+		if cid == "" {
+			cid = r.Cid
+		}
+		if w.cfg.Replication {
+			w.pending.Add(1)
+			go func(r araResult) {
+				defer w.pending.Done()
+				w.measureReplication(op, start, r, size)
+			}(r)
+		}
+	}
+
+	obj := op.object
+	obj.mutex.Lock()
+	if cid != "" {
+		obj.cid = cid
+		obj.writer = op.node
+		obj.file = file
+		obj.writes = times
+	}
+	obj.mutex.Unlock()
+	obj.once.Do(func() { close(obj.written) })
+
+	if cid == "" {
+		log.Lvl1("failedwriteoptime-"+op.node, "object", obj.id)
+	} else if !w.cfg.Sequence {
+		min := time.Duration(math.MaxInt64)
+		for _, t := range times {
+			if t < min {
+				min = t
+			}
+		}
+		log.Lvl1("writeoptime-"+op.node, min.Milliseconds())
+	}
+}
+
+// read reads the last written version of the object from the reader node,
+// in all the ARAs of the node or only in the ARA chosen by the router
+func (w *Workload) read(op *workloadOp, reader string) {
+	obj := op.object
+	<-obj.written
+	obj.mutex.Lock()
+	cid, writer, file := obj.cid, obj.writer, obj.file
+	size := int64(0)
+	if file != nil {
+		size = file.Size
+	}
+	writes := make(map[string]time.Duration)
+	for ara, t := range obj.writes {
+		writes[ara] = t
+	}
+	obj.mutex.Unlock()
+
+	id := "optime-" + writer + "-" + reader
+	if cid == "" {
+		log.Lvl1("failed"+id, "object", obj.id, "was not written")
+		return
+	}
+
+	kind, readAll := ReadRecord, readARAs
+	if w.cfg.Gateway {
+		kind, readAll = GatewayReadRecord, gatewayARAs
+	}
+
+	w.acquire(reader)
+	defer w.release(reader)
+	if !w.cfg.Routed {
+		start := time.Now()
+		res, err := readAll(reader, cid, file)
+		if err != nil {
+			res = []araResult{{Cid: cid, Err: err}}
+		}
+		reads := make(map[string]time.Duration)
+		for _, r := range res {
+			w.record(op, start, r, writer, reader, size, kind)
+			if r.Err != nil {
+				log.Lvl1("Read from", reader, "failed:", r.Err)
+				continue
+			}
+			reads[r.ARA] = r.Time
+		}
+		if len(reads) == 0 {
+			log.Lvl1("failed"+id, "object", obj.id)
+			return
+		}
+		logInteraction(id, writes, reads, size)
+		return
+	}
+
+	var err error
+	for _, c := range w.router.Route(writer, reader) {
+		t0, ok := writes[c.ID]
+		if !ok {
+			continue
+		}
+		cli, _ := w.router.Client(c.ID, reader)
+		routed := &RoutedOp{ARA: c.ID, Leader: c.Leader, Radius: c.Radius,
+			Cid: cid, Write: t0}
+		start := time.Now()
+		var res araResult
+		if w.cfg.Gateway {
+			gw, _ := w.router.Gateway(c.ID, reader)
+			res = catGateway(gw, cid, file)
+		} else {
+			res = cat(cli, cid, file)
+		}
+		res.ARA = c.ID
+		routed.Read, err = res.Time, res.Err
+		w.record(op, start, res, writer, reader, size, kind)
+		if err != nil {
+			log.Lvl1("Read from", reader, "in ARA of", c.Leader,
+				"failed:", err)
+			continue
+		}
+		logRouted(id, routed, size)
+		return
+	}
+	log.Lvl1("failed"+id, err)
+}
+
+// record writes a record of the given type of the operation in an ARA, if
+// records are enabled
+func (w *Workload) record(op *workloadOp, start time.Time, res araResult,
+	writer, reader string, size int64, kind string) {
+
+	if w.records == nil {
+		return
+	}
+	r := newRecord(op, kind, start, res)
+	r.Writer = writer
+	r.Reader = reader
+	r.Bytes = size
+	if (kind == ReadRecord || kind == GatewayReadRecord) && res.Err == nil {
+		r.Bytes = res.Bytes
+	}
+	if ara, ok := w.aras[res.ARA]; ok {
+		r.Radius = ara.Radius
+	}
+	if reader != "" {
+		r.RTT = w.pings[writer][reader]
+	}
+	if err := w.records.Write(r); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,35 @@
+package operations
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestScheduleReaders(t *testing.T) {
+	cfg := DefaultWorkloadConfig(200, 6)
+	cfg.Objects = 5
+	cfg.ReadRatio = 0.8
+	cfg.Readers = 2
+	w := &Workload{cfg: cfg, rnd: rand.New(rand.NewSource(1))}
+
+	// the readers of a version are known when it is written, so that a
+	// routed write goes to the ARAs shared with them
+	last := make(map[*workloadObject]*workloadOp)
+	for _, op := range w.schedule() {
+		if op.write {
+			last[op.object] = op
+			continue
+		}
+		write := last[op.object]
+		for _, reader := range op.readers {
+			found := false
+			for _, r := range write.readers {
+				found = found || r == reader
+			}
+			if !found || reader == write.node {
+				t.Fatal("reader", reader, "of object", op.object.id,
+					"unknown to its writer", write.node, write.readers)
+			}
+		}
+	}
+}
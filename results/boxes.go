@@ -1,15 +1,30 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
+	"os"
 	"strconv"
 	"strings"
 )
 
 var box = []float64{0, 50, 100, 150, 200, 250, 300, 1000}
 
+// record result of an operation, as written by the operations package
+type record struct {
+	Op      int     `json:"op"`
+	Object  int     `json:"object"`
+	Type    string  `json:"type"`
+	Reader  string  `json:"reader"`
+	ARA     string  `json:"ara"`
+	RTT     float64 `json:"rtt"`
+	Latency float64 `json:"latency"`
+	Cause   string  `json:"cause"`
+	Error   string  `json:"error"`
+}
+
 type pingRes struct {
 	Node1 string
 	Node2 string
@@ -115,6 +130,13 @@ func getNumbers(folder, filename string) ([]int, []int, []int, []int) {
 			}
 		}
 	}
+	wRet, wSd, rRet, rSd := stats(writes, reads)
+	return wRet, wSd, rRet, rSd
+}
+
+// stats returns the average and standard deviation of the write and read
+// times of each box
+func stats(writes, reads [][]int) ([]int, []int, []int, []int) {
 	wRet := make([]int, len(box))
 	rRet := make([]int, len(box))
 	wSd := make([]int, len(box))
@@ -148,10 +170,91 @@ func getNumbers(folder, filename string) ([]int, []int, []int, []int) {
 	return wRet, wSd, rRet, rSd
 }
 
+// getNumbersFromRecords returns the same numbers as getNumbers, computed from
+// the records of the operations instead of the output of the simulation. The
+// write time of a read is the time of the write of the object in the same ARA.
+func getNumbersFromRecords(filename string) ([]int, []int, []int, []int) {
+	b, err := ioutil.ReadFile(filename)
+	checkErr(err)
+
+	records := make([]record, 0)
+	writeTimes := make(map[int]map[string]float64) // object -> ARA -> ms
+	failures := make(map[string]int)               // type cause -> count
+	for _, l := range strings.Split(string(b), "\n") {
+		if l == "" {
+			continue
+		}
+		r := record{}
+		checkErr(json.Unmarshal([]byte(l), &r))
+		if r.Error != "" {
+			failures[r.Type+" "+r.Cause]++
+			continue
+		}
+		switch r.Type {
+		case "write":
+			if _, ok := writeTimes[r.Object]; !ok {
+				writeTimes[r.Object] = make(map[string]float64)
+			}
+			writeTimes[r.Object][r.ARA] = r.Latency
+		case "read", "gateway_read":
+			records = append(records, r)
+		}
+	}
+
+	// min write + read and min read of each read operation of each reader
+	type interaction struct {
+		total, read float64
+		rtt         float64
+	}
+	interactions := make(map[string]*interaction)
+	for _, r := range records {
+		w, ok := writeTimes[r.Object][r.ARA]
+		if !ok {
+			continue
+		}
+		key := strconv.Itoa(r.Op) + "-" + r.Reader
+		i, ok := interactions[key]
+		if !ok {
+			i = &interaction{total: math.MaxFloat64, read: math.MaxFloat64,
+				rtt: r.RTT}
+			interactions[key] = i
+		}
+		i.total = math.Min(i.total, w+r.Latency)
+		i.read = math.Min(i.read, r.Latency)
+	}
+
+	for f, n := range failures {
+		fmt.Println("Failed", f+":", n)
+	}
+
+	reads := make([][]int, len(box))
+	writes := make([][]int, len(box))
+	for _, i := range interactions {
+		w := int(i.total - i.read)
+		r := int(i.read)
+		writes[len(box)-1] = append(writes[len(box)-1], w)
+		reads[len(box)-1] = append(reads[len(box)-1], r)
+		for j := 0; j < len(box)-1; j++ {
+			if i.rtt > box[j] && i.rtt < box[j+1] {
+				writes[j] = append(writes[j], w)
+				reads[j] = append(reads[j], r)
+				break
+			}
+		}
+	}
+	return stats(writes, reads)
+}
+
 func printBoxes(folder, sim string) {
 	filename := folder + "/output_" + sim + ".txt"
 
-	wAvg, wStdev, rAvg, rStdev := getNumbers(folder, filename)
+	var wAvg, wStdev, rAvg, rStdev []int
+	if _, err := os.Stat(folder + "/records.jsonl"); err == nil {
+		wAvg, wStdev, rAvg, rStdev =
+			getNumbersFromRecords(folder + "/records.jsonl")
+	} else {
+		wAvg, wStdev, rAvg, rStdev = getNumbers(folder, filename)
+	}
 
 	sum := make([]int, len(box))
 	for i := 0; i < len(wAvg); i++ {
@@ -18,6 +18,7 @@ f_t=0
 f_pings=false
 f_van=false
 f_crux=false
+f_shared=false
 f_N=0
 f_K=0
 
@@ -38,8 +39,9 @@ while test $# -gt 0; do
       #echo "-K                          specify the number of ARA levels"
       #echo "-N                          specify the number of nodes"
       echo "  -p, --pings                 specify to compute new ping distances"
-      echo "  -m, --mode=MODE             specifiy ipfs-cluster mode (raft/crdt)"
+      echo "  -m, --mode=MODE             specifiy ipfs-cluster mode (raft/crdt/raft,crdt)"
       echo "  -o, --operations=O          specify the number of operations to perform (int)"
+      echo "  -s, --shared                run a single ipfs daemon per node, shared by all ARAs"
       exit 0
       ;;
 
@@ -120,6 +122,11 @@ while test $# -gt 0; do
         shift
         ;;
 
+    -s|--shared)
+        f_shared=true
+        shift
+        ;;
+
     -t)
         shift
         if test $# -gt 0; then
@@ -190,9 +197,11 @@ if ! [ -f "$DETFILE" ]; then
         ops=$d_ops
     fi
 
-    # mode: raft/crdt
+    # mode: raft/crdt, or both to mix raft and crdt ARAs
     if [ "$f_mode" = "raft" ]; then
         mode=raft
+    elif [ "$f_mode" = "raft,crdt" ] || [ "$f_mode" = "crdt,raft" ]; then
+        mode=$f_mode
     else
         mode=crdt
     fi
@@ -241,7 +250,8 @@ else
     fi
 
     if ! [ "$f_mode" = '' ]; then
-        if [ "$f_mode" = 'raft' ] || [ "$f_mode" = 'crdt' ];then
+        if [ "$f_mode" = 'raft' ] || [ "$f_mode" = 'crdt' ] ||
+            [ "$f_mode" = 'raft,crdt' ] || [ "$f_mode" = 'crdt,raft' ];then
             mode=$f_mode
         fi
     fi
@@ -264,6 +274,9 @@ else
 fi
 
 path='../results/K'$K'N'$N'D'$D$deploy'O'$ops$mode
+if $f_shared; then
+    path=$path'shared'
+fi
 
 mkdir $path
 mkdir $path'/data'
@@ -293,6 +306,7 @@ if ! $f_crux; then
     echo 'pings='$pings >> $DETFILE
     echo 'mode='$mode >> $DETFILE
     echo 'cruxified='$cruxified >> $DETFILE
+    echo 'sharedipfs='$f_shared >> $DETFILE
 
     rm $output_v > /dev/null 2>&1
 
@@ -335,6 +349,7 @@ if ! $f_van; then
     echo 'pings='$pings >> $DETFILE
     echo 'mode='$mode >> $DETFILE
     echo 'cruxified='$cruxified >> $DETFILE
+    echo 'sharedipfs='$f_shared >> $DETFILE
 
     rm $output_c > /dev/null 2>&1
 
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// InstanceKind kind of daemon handled by an InstanceBackend
+type InstanceKind int
+
+const (
+	// IPFSKind IPFS daemon
+	IPFSKind InstanceKind = iota
+	// ClusterKind IPFS Cluster daemon
+	ClusterKind
+)
+
+// String returns the name of the kind of instance
+func (k InstanceKind) String() string {
+	if k == ClusterKind {
+		return "cluster"
+	}
+	return "ipfs"
+}
+
+// Instance describes an IPFS or an IPFS Cluster daemon owned by a node
+type Instance struct {
+	Kind   InstanceKind
+	Node   string // name of the node owning the instance
+	Secret string // secret of the ARA of the instance
+	Path   string // path of the repo of the instance
+	PeerID string // set by the backend when initializing the instance
+	Ports  []int  // ports reserved for the instance
+
+	// IPFS instances only
+	IPFSProfile *IPFSProfile
+
+	// IPFS Cluster instances only
+	Cluster     *ClusterInstance
+	Profile     *ClusterProfile
+	IPFSAPIAddr string
+	Bootstrap   string
+}
+
+// InstanceBackend initializes, starts and stops IPFS and IPFS Cluster
+// instances. The service uses the ExecBackend, running the ipfs and
+// ipfs-cluster-service binaries, the FakeBackend simulates the instances in
+// memory so that the protocols can run without the binaries.
+type InstanceBackend interface {
+	// Init creates the repo and the configuration of the instance
+	Init(i *Instance) error
+	// Start launches the instance, without waiting for it to be ready
+	Start(i *Instance) error
+	// Stop stops a started instance
+	Stop(i *Instance) error
+	// APIAddr returns the multiaddress of the API of the instance, the IPFS
+	// API or the cluster REST API
+	APIAddr(i *Instance) string
+	// Ready returns true if the instance answers on its API
+	Ready(i *Instance) bool
+}
+
+// ResourceReporter is implemented by the backends able to report the memory
+// used by their instances
+type ResourceReporter interface {
+	// MemoryUsage returns the resident memory of the instance in KiB
+	MemoryUsage(i *Instance) (uint64, error)
+}
+
+// HealthChecker is implemented by the backends able to query the state of
+// their instances
+type HealthChecker interface {
+	// Health returns the peers and pins seen by the instance
+	Health(i *Instance) InstanceHealth
+}
+
+// CrashNotifier is implemented by the backends able to detect that an
+// instance exited without being stopped
+type CrashNotifier interface {
+	// SetCrashHandler sets the function called when an instance crashes
+	SetCrashHandler(f func(i *Instance, err error))
+}
+
+// ResourceUsage returns the resources used by the instances of the node
+func (s *Service) ResourceUsage() ResourceReport {
+	r := ResourceReport{}
+	reporter, canReport := s.Backend.(ResourceReporter)
+
+	s.InstancesMutex.Lock()
+	defer s.InstancesMutex.Unlock()
+	for _, i := range s.Instances {
+		if i.Kind == ClusterKind {
+			r.ClusterDaemons++
+			r.Ports += ClusterPortNumber
+		} else {
+			r.IPFSDaemons++
+			r.Ports += IPFSPortNumber
+		}
+		if canReport {
+			mem, err := reporter.MemoryUsage(i)
+			if err != nil {
+				log.Lvl2(err)
+				continue
+			}
+			r.MemoryKiB += mem
+		}
+	}
+	return r
+}
+
+// Add returns the sum of both reports
+func (r ResourceReport) Add(o ResourceReport) ResourceReport {
+	return ResourceReport{
+		IPFSDaemons:    r.IPFSDaemons + o.IPFSDaemons,
+		ClusterDaemons: r.ClusterDaemons + o.ClusterDaemons,
+		Ports:          r.Ports + o.Ports,
+		MemoryKiB:      r.MemoryKiB + o.MemoryKiB,
+	}
+}
+
+// String returns a one line summary of the report
+func (r ResourceReport) String() string {
+	return fmt.Sprintf("%d ipfs daemons, %d cluster daemons, %d ports, "+
+		"%d KiB resident memory", r.IPFSDaemons, r.ClusterDaemons, r.Ports,
+		r.MemoryKiB)
+}
+
+// waitReady waits until the given instance is ready or until timeout
+func (s *Service) waitReady(i *Instance, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !s.Backend.Ready(i) {
+		if time.Now().After(deadline) {
+			return errors.New(i.Kind.String() + " instance of " + i.Node +
+				" not ready after " + timeout.String())
+		}
+		time.Sleep(ReadyPollInterval)
+	}
+	log.Lvl3(i.Kind.String(), "instance of", i.Node, "ready at",
+		s.Backend.APIAddr(i))
+	return nil
+}
+
+// ipfsSwarmAddr returns the multiaddress that other IPFS instances can use to
+// bootstrap to the given IPFS instance
+func ipfsSwarmAddr(i *Instance) string {
+	if len(i.IPFSProfile.SwarmAddrs) == 0 || i.PeerID == "" {
+		return ""
+	}
+	return i.IPFSProfile.SwarmAddrs[0] + "/ipfs/" + i.PeerID
+}
+
+// clusterAPIAddr returns the REST API multiaddress of a cluster instance
+func clusterAPIAddr(c *ClusterInstance) string {
+	return c.RestAPIAddr
+}
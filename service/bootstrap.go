@@ -0,0 +1,107 @@
+package service
+
+import (
+	"net"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// clusterBootstrapAddr returns the multiaddress that other cluster peers can
+// use to bootstrap to the given cluster instance
+func clusterBootstrapAddr(c *ClusterInstance) string {
+	addr := c.ClusterAddr
+	if c.PeerID != "" {
+		addr += "/ipfs/" + c.PeerID
+	}
+	return addr
+}
+
+// appendAddr appends the address to the list of candidate bootstrap peers,
+// unless it is empty
+func appendAddr(addrs []string, addr string) []string {
+	if addr == "" {
+		return addrs
+	}
+	return append(addrs, addr)
+}
+
+// selectBootstrap returns the first reachable address of the ordered list of
+// candidates, or the first candidate if none of them answers
+func selectBootstrap(candidates []string) string {
+	for _, c := range candidates {
+		if reachable(c) {
+			return c
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return ""
+}
+
+// reachable returns true if a tcp connection can be opened to the given
+// multiaddress, non tcp multiaddresses are never reachable. The cluster
+// listeners always use tcp, whatever the swarm transport.
+func reachable(addr string) bool {
+	host, err := HTTPAddr(addr)
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", host, BootstrapDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// designate asks the children of the node, one after the other, to start as
+// the bootstrap of the ARA of leader until one of them succeeds, send sends
+// the designation to a child. Only the reply of the designated child is
+// accepted, late replies of the children that timed out are dropped. It
+// returns the cluster and ipfs bootstrap addresses, and the children that
+// were not designated.
+func designate(n *onet.TreeNodeInstance, replies chan bootstrapWrapperStartARA,
+	timeout time.Duration, leader string, send func(c *onet.TreeNode) error) (
+	[]string, []string, []*onet.TreeNode) {
+
+	children := n.Children()
+	for i, c := range children {
+		log.Lvl1("Designating", c.ServerIdentity, "as bootstrap of the ARA of",
+			leader)
+		if err := send(c); err != nil {
+			log.Error(err)
+			continue
+		}
+		deadline := time.After(timeout)
+	wait:
+		for {
+			select {
+			case b := <-replies:
+				if b.TreeNode.ID != c.ID {
+					log.Lvl2("Dropping the late bootstrap of",
+						b.TreeNode.ServerIdentity)
+					continue
+				}
+				if b.Bootstrap != "" {
+					return []string{b.Bootstrap},
+						appendAddr(nil, b.IPFSBootstrap), children[i+1:]
+				}
+				break wait
+			case <-deadline:
+				log.Error(c.ServerIdentity, "did not start as bootstrap after",
+					timeout)
+				break wait
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// quorum returns the minimal number of members of an ARA of the given size
+// that must be up for the ARA to be formed
+func quorum(size int) int {
+	return size/2 + 1
+}
@@ -1,12 +1,13 @@
 package service
 
 import (
-	"fmt"
+	"errors"
 	"path/filepath"
-	"strconv"
+	"time"
 
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
 )
 
 // Check that *StartIPFSProtocol implements onet.ProtocolInstance
@@ -19,8 +20,11 @@ func NewClusterBootstrapProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 		TreeNodeInstance: n,
 		Ready:            make(chan bool),
 		GetService:       getServ,
+		Timeout:          ProtocolTimeout,
 	}
-	if err := n.RegisterChannels(&t.announceChan, &t.repliesChan); err != nil {
+	err := n.RegisterChannels(&t.announceChan, &t.repliesChan,
+		&t.bootstrapChan)
+	if err != nil {
 		return nil, err
 	}
 	return t, nil
@@ -29,7 +33,8 @@ func NewClusterBootstrapProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 // Start sends the Announce-message to all children
 func (p *ClusterBootstrapProtocol) Start() error {
 	log.Lvl2(p.GetService().Name, "starting an ARA")
-	return p.SendTo(p.TreeNode(), &ClusterBootstrapAnnounce{})
+	return p.SendTo(p.TreeNode(),
+		&ClusterBootstrapAnnounce{Timeout: p.Timeout})
 }
 
 // Dispatch implements the main logic of the protocol. The function is only
@@ -40,78 +45,165 @@ func (p *ClusterBootstrapProtocol) Dispatch() error {
 	// of nodes
 	defer p.Done()
 
-	ann := <-p.announceChan
 	s := p.GetService()
-
-	apiIPFSAddr := IPVersion + s.MyIPFS[0].IP +
-		TransportProtocol + strconv.Itoa(s.MyIPFS[0].APIPort) // 5001
+	var ann announceWrapperClusterBootstrap
+	select {
+	case ann = <-p.announceChan:
+	case <-time.After(p.Timeout):
+		return errors.New(s.Name + " got no " + ClusterBootstrapName +
+			" announce after " + p.Timeout.String())
+	}
+	p.Timeout = ann.Timeout
+	deadline := time.Now().Add(p.Timeout)
+	height := subtreeHeight(p.TreeNode())
+	round := monitor.NewTimeMeasure(roundMeasurePrefix + ClusterBootstrapName)
 
 	if p.IsRoot() {
 		// generate secret
-		secret := genSecret()
-
-		// set cluster path
-		clusterPath := filepath.Join(s.ConfigPath,
-			ClusterFolderPrefix+s.Name+"-"+secret)
+		ann.SenderName = s.Name
+		ann.Secret = genSecret()
+		ann.Profile = p.Profile
+		ann.Designated = true
+	}
 
-		// start cluster leader
-		secret, info, err := s.SetupClusterLeader(clusterPath, secret,
-			apiIPFSAddr, DefaultReplMin, DefaultReplMax)
-		checkErr(err)
+	// set cluster path
+	clusterPath := filepath.Join(s.ConfigPath,
+		ClusterFolderPrefix+ann.SenderName+"-"+ann.Secret)
 
-		p.Info = ClusterInfo{
-			Leader:    s.Name,
-			Secret:    secret,
-			Instances: make([]ClusterInstance, 1),
+	var cluster *ClusterInstance
+	var err error
+	if !ann.Designated && len(ann.Bootstraps) == 0 {
+		err = errors.New("no bootstrap peer for the ARA of " + ann.SenderName)
+	} else if s.PrivateIPFS {
+		// the ARA members run their own private ipfs network, as in StartARA
+		var bootstraps []string
+		if !ann.Designated {
+			bootstraps = ann.Bootstraps
+		}
+		cluster, err = s.StartIPFSAndCluster(ann.SenderName, ann.Secret,
+			bootstraps, ann.IPFSBootstrap, &ann.Profile)
+	} else if len(s.MyIPFS) == 0 {
+		err = errors.New("no ipfs instance running")
+	} else {
+		var apiIPFSAddr string // 5001
+		apiIPFSAddr, err = s.Addrs.TCPAddr(s.MyIPFS[0].IP,
+			s.MyIPFS[0].APIPort)
+		if err == nil && ann.Designated {
+			// start as the ARA bootstrap
+			_, cluster, err = s.SetupClusterLeader(clusterPath, ann.Secret,
+				apiIPFSAddr, &ann.Profile)
+		} else if err == nil {
+			// bootstrap peer
+			cluster, err = s.SetupClusterSlave(clusterPath,
+				selectBootstrap(ann.Bootstraps), ann.Secret, apiIPFSAddr,
+				&ann.Profile)
 		}
-		p.Info.Instances[0] = *info
-
-		if len(p.TreeNodeInstance.Children()) > 0 {
-			bootstrap := info.IP + strconv.Itoa(info.ClusterPort)
-			p.SendToChildren(&ClusterBootstrapAnnounce{
-				SenderName: s.Name,
-				Bootstrap:  bootstrap,
-				Secret:     secret,
+		if err == nil {
+			// only used to measure the reads through the gateway
+			cluster.GatewayAddr, _ = s.Addrs.TCPAddr(s.MyIPFS[0].IP,
+				s.MyIPFS[0].GatewayPort)
+		}
+	}
+
+	status := newNodeStatus(s.Name)
+	instances := make([]ClusterInstance, 0)
+	if err != nil {
+		log.Error(s.Name, "failed to join the ARA of", ann.SenderName+":", err)
+		status.addError(err)
+	} else {
+		instances = append(instances, *cluster)
+	}
+	statuses := []NodeStatus{status}
+
+	// candidate bootstrap peers for the children
+	fwd := ann.ClusterBootstrapAnnounce
+	fwd.Designated = false
+	children := p.Children()
+	if cluster == nil && ann.Designated {
+		// find a new bootstrap in the subtree
+		d := fwd
+		d.Designated = true
+		d.Bootstraps = nil
+		fwd.Bootstraps, fwd.IPFSBootstrap, children = designate(
+			p.TreeNodeInstance, p.bootstrapChan,
+			levelTimeout(deadline, height), ann.SenderName,
+			func(c *onet.TreeNode) error {
+				d.Timeout = levelTimeout(deadline, height)
+				return p.SendTo(c, &d)
 			})
-			replies := <-p.repliesChan
-			for i := 0; i < len(replies); i++ {
-				p.Info.Instances = append(p.Info.Instances,
-					*replies[i].Cluster...)
-			}
+	} else if ann.Designated {
+		fwd.Bootstraps = []string{clusterBootstrapAddr(cluster)}
+		fwd.IPFSBootstrap = appendAddr(nil, cluster.IPFSSwarmAddr)
+	} else if cluster != nil {
+		// fall back on this node if the previous candidates are down, the
+		// ipfs swarm address is only set with private networks
+		fwd.Bootstraps = append(append([]string{}, ann.Bootstraps...),
+			clusterBootstrapAddr(cluster))
+		fwd.IPFSBootstrap = appendAddr(
+			append([]string{}, ann.IPFSBootstrap...), cluster.IPFSSwarmAddr)
+	}
+
+	if ann.Designated && !p.IsRoot() {
+		// tell the parent which bootstrap was started
+		b := &StartARABootstrap{}
+		if len(fwd.Bootstraps) > 0 {
+			b.Bootstrap = fwd.Bootstraps[0]
 		}
-		p.Info.Size = len(p.Info.Instances)
-		p.Ready <- true
-		return nil
-	} else if !p.IsLeaf() {
-		p.SendToChildren(&ann.ClusterBootstrapAnnounce)
-		replies := <-p.repliesChan
-
-		clusterPath := filepath.Join(s.ConfigPath,
-			ClusterFolderPrefix+ann.SenderName+"-"+ann.Secret)
-
-		// bootstrap peer
-		cluster, err := s.SetupClusterSlave(clusterPath, ann.Bootstrap,
-			ann.Secret, apiIPFSAddr, DefaultReplMin, DefaultReplMax)
-		if err != nil {
-			fmt.Println("Error slave:", err)
+		if len(fwd.IPFSBootstrap) > 0 {
+			b.IPFSBootstrap = fwd.IPFSBootstrap[0]
 		}
-		instances := make([]ClusterInstance, 0)
-		for _, r := range replies {
-			instances = append(instances, *r.Cluster...)
+		if err := p.SendToParent(b); err != nil {
+			log.Error(err)
 		}
-		instances = append(instances, *cluster)
-		return p.SendToParent(&ClusterBootstrapReply{Cluster: &instances})
 	}
-	// leaf
-	clusterPath := filepath.Join(s.ConfigPath,
-		ClusterFolderPrefix+ann.SenderName+"-"+ann.Secret)
 
-	// bootstrap peer
-	cluster, err := s.SetupClusterSlave(clusterPath, ann.Bootstrap, ann.Secret,
-		apiIPFSAddr, DefaultReplMin, DefaultReplMax)
-	if err != nil {
-		fmt.Println("Error slave:", err)
+	if !p.IsLeaf() {
+		fwd.Timeout = levelTimeout(deadline, height)
+		for _, c := range children {
+			if err := p.SendTo(c, &fwd); err != nil {
+				log.Error(err)
+			}
+		}
+
+		// wait for children replies
+		replied := make(map[onet.TreeNodeID]bool)
+		timeout := time.After(time.Until(deadline))
+	wait:
+		for len(replied) < len(p.Children()) {
+			select {
+			case r := <-p.repliesChan:
+				replied[r.TreeNode.ID] = true
+				if r.Cluster != nil {
+					instances = append(instances, *r.Cluster...)
+				}
+				statuses = append(statuses, r.Status...)
+			case <-timeout:
+				statuses = append(statuses,
+					s.missingStatus(p.TreeNodeInstance, replied, p.Timeout)...)
+				break wait
+			}
+		}
+	}
+
+	if !p.IsRoot() {
+		return p.SendToParent(&ClusterBootstrapReply{
+			Cluster: &instances,
+			Status:  statuses,
+		})
+	}
+
+	// root
+	p.Info = ClusterInfo{
+		Leader:    s.Name,
+		Secret:    ann.Secret,
+		Size:      len(instances),
+		Members:   p.Tree().Size(),
+		Profile:   p.Profile,
+		Instances: instances,
 	}
-	return p.SendToParent(&ClusterBootstrapReply{
-		Cluster: &[]ClusterInstance{*cluster}})
+	p.Report, p.Success = mergeStatus(statuses)
+	logReport(ClusterBootstrapName+" of "+s.Name, p.Report)
+	round.Record()
+	p.Ready <- true
+	return nil
 }
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	ipfscluster "github.com/ipfs/ipfs-cluster"
+	"github.com/ipfs/ipfs-cluster/cmdutils"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.dedis.ch/onet/v3/log"
+)
+
+const (
+	// ClusterServiceFile name of the cluster peer configuration file
+	ClusterServiceFile = "service.json"
+	// ClusterIdentityFile name of the cluster peer identity file
+	ClusterIdentityFile = "identity.json"
+	// ClusterPeerstoreFile name of the file where a cluster peer saves the
+	// addresses of the peers it knows
+	ClusterPeerstoreFile = "peerstore"
+)
+
+// ClusterProfile settings of an ARA cluster, chosen by the ARA root and
+// shared with all the members of the ARA
+type ClusterProfile struct {
+	Consensus  string // "raft" or "crdt"
+	ReplMin    int
+	ReplMax    int
+	Allocator  string // "disk", the only allocator of ipfs-cluster-service
+	PinTracker string // "map" or "stateless"
+}
+
+// ClusterIdentity content of the identity.json file of a cluster peer
+type ClusterIdentity struct {
+	ID         string `json:"id"`
+	PrivateKey string `json:"private_key"`
+}
+
+// DefaultClusterProfile returns the cluster profile used when nothing else is
+// specified in the InitRequest
+func DefaultClusterProfile() ClusterProfile {
+	return ClusterProfile{
+		Consensus:  DefaultClusterConsensus,
+		ReplMin:    DefaultReplMin,
+		ReplMax:    DefaultReplMax,
+		Allocator:  DefaultClusterAllocator,
+		PinTracker: DefaultClusterPinTracker,
+	}
+}
+
+// ParseClusterProfiles builds the cluster profiles from the InitRequest. The
+// mode can be a comma separated list of consensus ("raft,crdt"), in which
+// case the ARAs rooted at a node cycle through the given consensus.
+func ParseClusterProfiles(req *InitRequest) ([]ClusterProfile, error) {
+	base := DefaultClusterProfile()
+	if req.ReplMin != 0 {
+		base.ReplMin = req.ReplMin
+	}
+	if req.ReplMax != 0 {
+		base.ReplMax = req.ReplMax
+	}
+	if req.Allocator != "" && req.Allocator != DefaultClusterAllocator {
+		// the daemon always allocates with the disk informer
+		return nil, errors.New("unsupported cluster allocator " +
+			req.Allocator)
+	}
+	if req.PinTracker != "" {
+		base.PinTracker = req.PinTracker
+	}
+
+	profiles := make([]ClusterProfile, 0)
+	for _, m := range strings.Split(req.Mode, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		p := base
+		p.Consensus = m
+		profiles = append(profiles, p)
+	}
+	if len(profiles) == 0 {
+		profiles = append(profiles, base)
+	}
+	return profiles, nil
+}
+
+// clusterProfile returns the profile of the i-th ARA rooted at the node
+func (s *Service) clusterProfile(i int) ClusterProfile {
+	if len(s.ClusterProfiles) == 0 {
+		return DefaultClusterProfile()
+	}
+	return s.ClusterProfiles[i%len(s.ClusterProfiles)]
+}
+
+// DaemonArgs returns the arguments of the cluster daemon for this profile
+func (p *ClusterProfile) DaemonArgs() []string {
+	args := make([]string, 0)
+	if p.PinTracker != "" {
+		args = append(args, "--pintracker", p.PinTracker)
+	}
+	return args
+}
+
+// InitClusterConfig creates the identity and the service.json of a cluster
+// peer at the given path. The identity and the default configuration are
+// generated by ipfs-cluster-service, the fields depending on the ARA and on
+// the node are then set natively.
+func InitClusterConfig(path, peername, secret, apiIPFSAddr string,
+	ports ClusterInstance, p *ClusterProfile) error {
+
+	args := []string{"-c", path, "init"}
+	if p.Consensus != "" {
+		args = append(args, "--consensus", p.Consensus)
+	}
+	o, err := exec.Command("ipfs-cluster-service", args...).CombinedOutput()
+	if err != nil {
+		log.Lvl1(string(o))
+		return err
+	}
+
+	return ApplyClusterProfile(path, peername, secret, apiIPFSAddr, ports, p)
+}
+
+// ApplyClusterProfile sets the fields of the service.json of the cluster peer
+// at the given path that depend on the ARA and on the node. The file is
+// loaded into the typed configuration sections of ipfs-cluster, so that it is
+// validated and written back with the same fields.
+func ApplyClusterProfile(path, peername, secret, apiIPFSAddr string,
+	ports ClusterInstance, p *ClusterProfile) error {
+
+	h := cmdutils.NewConfigHelper(filepath.Join(path, ClusterServiceFile),
+		filepath.Join(path, ClusterIdentityFile), p.Consensus)
+	defer h.Manager().Shutdown()
+	if err := h.LoadConfigFromDisk(); err != nil {
+		return err
+	}
+	cfgs := h.Configs()
+
+	var err error
+	cfgs.Cluster.Peername = peername
+	cfgs.Cluster.Secret, err = ipfscluster.DecodeClusterSecret(secret)
+	if err != nil {
+		return err
+	}
+	cfgs.Cluster.ReplicationFactorMin = p.ReplMin
+	cfgs.Cluster.ReplicationFactorMax = p.ReplMax
+	for _, a := range []struct {
+		field *ma.Multiaddr
+		addr  string
+	}{
+		{&cfgs.Cluster.ListenAddr, ports.ClusterAddr},
+		{&cfgs.Restapi.HTTPListenAddr, ports.RestAPIAddr},
+		{&cfgs.Ipfsproxy.ListenAddr, ports.IPFSProxyAddr},
+		{&cfgs.Ipfsproxy.NodeAddr, apiIPFSAddr},
+		{&cfgs.Ipfshttp.NodeAddr, apiIPFSAddr},
+	} {
+		if *a.field, err = ma.NewMultiaddr(a.addr); err != nil {
+			return err
+		}
+	}
+	if err := h.Manager().Validate(); err != nil {
+		return err
+	}
+	return h.SaveConfigToDisk()
+}
+
+// ReadClusterIdentity reads the identity.json of the cluster peer at the
+// given path
+func ReadClusterIdentity(path string) (*ClusterIdentity, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, ClusterIdentityFile))
+	if err != nil {
+		return nil, err
+	}
+	id := &ClusterIdentity{}
+	if err := json.Unmarshal(b, id); err != nil {
+		return nil, err
+	}
+	if id.ID == "" {
+		return nil, errors.New("empty cluster identity in " + path)
+	}
+	return id, nil
+}
+
+// ReadClusterPeerstore reads the multiaddresses of the peers known by the
+// cluster peer at the given path
+func ReadClusterPeerstore(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, ClusterPeerstoreFile))
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0)
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			addrs = append(addrs, line)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/cmdutils"
+)
+
+func TestParseClusterProfiles(t *testing.T) {
+	// defaults
+	profiles, err := ParseClusterProfiles(&InitRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 || profiles[0] != DefaultClusterProfile() {
+		t.Fatal("wrong default profiles:", profiles)
+	}
+
+	// one profile per consensus, sharing the other options
+	profiles, err = ParseClusterProfiles(&InitRequest{
+		Mode:       "raft, crdt,",
+		ReplMin:    1,
+		ReplMax:    3,
+		Allocator:  "disk",
+		PinTracker: "stateless",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 {
+		t.Fatal("expected 2 profiles, got", len(profiles))
+	}
+	for i, consensus := range []string{"raft", "crdt"} {
+		p := profiles[i]
+		if p.Consensus != consensus {
+			t.Fatal("profile", i, "has consensus", p.Consensus)
+		}
+		if p.ReplMin != 1 || p.ReplMax != 3 || p.Allocator != "disk" ||
+			p.PinTracker != "stateless" {
+			t.Fatal("wrong options of profile", i, p)
+		}
+	}
+
+	// the ARAs of a node cycle through the profiles
+	s := &Service{ClusterProfiles: profiles}
+	if s.clusterProfile(2).Consensus != "raft" ||
+		s.clusterProfile(3).Consensus != "crdt" {
+		t.Fatal("ARAs do not cycle through the profiles")
+	}
+
+	// the daemon has no other allocator
+	_, err = ParseClusterProfiles(&InitRequest{Allocator: "numpin"})
+	if err == nil {
+		t.Fatal("no error for the numpin allocator")
+	}
+	p := DefaultClusterProfile()
+	for _, arg := range p.DaemonArgs() {
+		if arg == "--alloc" {
+			t.Fatal("the daemon has no allocator flag")
+		}
+	}
+}
+
+func TestApplyClusterProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cruxipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// default service.json, as written by ipfs-cluster-service init
+	p := DefaultClusterProfile()
+	h := cmdutils.NewConfigHelper(filepath.Join(dir, ClusterServiceFile),
+		filepath.Join(dir, ClusterIdentityFile), p.Consensus)
+	defer h.Manager().Shutdown()
+	if err := h.Manager().Default(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SaveConfigToDisk(); err != nil {
+		t.Fatal(err)
+	}
+
+	ports := ClusterInstance{
+		RestAPIAddr:   "/ip4/10.0.0.1/tcp/14000",
+		IPFSProxyAddr: "/ip4/10.0.0.1/tcp/14001",
+		ClusterAddr:   "/ip4/10.0.0.1/tcp/14002",
+	}
+	p.ReplMin, p.ReplMax = 1, 3
+	err = ApplyClusterProfile(dir, "node_1", genSecret(),
+		"/ip4/10.0.0.1/tcp/14003", ports, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h = cmdutils.NewConfigHelper(filepath.Join(dir, ClusterServiceFile),
+		filepath.Join(dir, ClusterIdentityFile), p.Consensus)
+	defer h.Manager().Shutdown()
+	if err := h.LoadConfigFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	cfgs := h.Configs()
+	if cfgs.Cluster.Peername != "node_1" || len(cfgs.Cluster.Secret) != 32 ||
+		cfgs.Cluster.ReplicationFactorMin != 1 ||
+		cfgs.Cluster.ReplicationFactorMax != 3 {
+		t.Fatal("wrong cluster section", cfgs.Cluster.Peername,
+			cfgs.Cluster.ReplicationFactorMin,
+			cfgs.Cluster.ReplicationFactorMax)
+	}
+	if cfgs.Cluster.ListenAddr.String() != ports.ClusterAddr ||
+		cfgs.Restapi.HTTPListenAddr.String() != ports.RestAPIAddr ||
+		cfgs.Ipfsproxy.ListenAddr.String() != ports.IPFSProxyAddr ||
+		cfgs.Ipfshttp.NodeAddr.String() != "/ip4/10.0.0.1/tcp/14003" {
+		t.Fatal("wrong listen addresses")
+	}
+
+	// an invalid replication factor is rejected
+	p.ReplMin, p.ReplMax = 3, 1
+	err = ApplyClusterProfile(dir, "node_1", genSecret(),
+		"/ip4/10.0.0.1/tcp/14003", ports, &p)
+	if err == nil {
+		t.Fatal("no error for a minimal replication above the maximal one")
+	}
+}
@@ -3,8 +3,13 @@ package service
 import "time"
 
 const (
-	// ClusterConsensusMode "raft" or "crdt"
-	ClusterConsensusMode = "raft"
+	// DefaultClusterConsensus "raft" or "crdt"
+	DefaultClusterConsensus = "raft"
+	// DefaultClusterAllocator ipfs cluster allocator, ipfs-cluster-service
+	// always allocates with the disk informer
+	DefaultClusterAllocator = "disk"
+	// DefaultClusterPinTracker ipfs cluster pin tracker, "map" or "stateless"
+	DefaultClusterPinTracker = "map"
 
 	// DefaultReplMin ipfs cluster minimal replication factor
 	DefaultReplMin = 2
@@ -14,10 +19,12 @@ const (
 	// BaseHostPort first port allocated to a node
 	BaseHostPort = 14000
 
-	// IPVersion default ip version
-	IPVersion = "/ip4/"
-	// TransportProtocol default transport protocol
-	TransportProtocol = "/tcp/"
+	// DefaultSwarmTransport transport of the ipfs swarm
+	DefaultSwarmTransport = "tcp"
+
+	// DefaultMaxConcurrentStarts max number of instances started at the same
+	// time on a node
+	DefaultMaxConcurrentStarts = 4
 
 	// MaxPortNumberPerHost max number of ports that a host can use
 	MaxPortNumberPerHost = 200
@@ -26,15 +33,48 @@ const (
 	// ClusterPortNumber number of ports used by an ipfs cluster instance
 	ClusterPortNumber = 3
 
-	// IPFSStartupTime IPFSStartupTime
-	IPFSStartupTime = 13 * time.Second
-	// ClusterStartupTime ClusterStartupTime
-	ClusterStartupTime = 2 * time.Second
+	// DefaultIPFSRouting routing mode of the IPFS instances
+	DefaultIPFSRouting = "dht"
+	// DefaultConnMgrLowWater ipfs connection manager low water mark
+	DefaultConnMgrLowWater = 100
+	// DefaultConnMgrHighWater ipfs connection manager high water mark
+	DefaultConnMgrHighWater = 400
+	// DefaultConnMgrGracePeriod ipfs connection manager grace period
+	DefaultConnMgrGracePeriod = "20s"
+
+	// IPFSStartupTime max time to wait for an IPFS instance to be ready
+	IPFSStartupTime = 30 * time.Second
+	// ClusterStartupTime max time to wait for a cluster instance to be ready
+	ClusterStartupTime = 30 * time.Second
+	// ReadyPollInterval interval between two readiness checks of an instance
+	ReadyPollInterval = 500 * time.Millisecond
+	// InstanceStopTimeout time given to an instance to exit before killing it
+	InstanceStopTimeout = 10 * time.Second
+	// MaxInstanceRestarts max number of relaunches of a crashed instance
+	MaxInstanceRestarts = 3
+	// RestartDelay time to wait before relaunching a crashed instance, doubled
+	// after each failed attempt
+	RestartDelay = 2 * time.Second
+	// DefaultRelaunchAttempts max number of attempts to relaunch a crashed
+	// instance
+	DefaultRelaunchAttempts = 3
+	// BootstrapDialTimeout timeout to check that a bootstrap peer is alive
+	BootstrapDialTimeout = 2 * time.Second
+	// ProtocolTimeout max time a node waits for a message of a startup
+	// protocol
+	ProtocolTimeout = 15 * time.Minute
+	// HealthRequestTimeout timeout of the API requests of a health check
+	HealthRequestTimeout = 10 * time.Second
+	// ClusterLogFile output of a cluster daemon, in the repo of the instance
+	ClusterLogFile = "daemon.log"
 
 	// ConfigsFolder folder name
 	ConfigsFolder = "configs"
 	// IPFSFolder ipfs config folder name
 	IPFSFolder = "ipfs"
+	// SharedIPFSSuffix suffix of the repo of the ipfs instance shared by all
+	// the ARAs of a node
+	SharedIPFSSuffix = "shared"
 	// ClusterFolderPrefix prefix of cluster configs folder name
 	ClusterFolderPrefix = "cluster-"
 
@@ -54,6 +94,10 @@ const (
 	StartARAName = "StartARA"
 	// StartInstancesName name of the StartInstancesName protocol
 	StartInstancesName = "StartInstances"
+	// StopInstancesName name of the StopInstances protocol
+	StopInstancesName = "StopInstances"
+	// HealthName name of the Health protocol
+	HealthName = "Health"
 
 	// PingsFile File with stored pings
 	PingsFile = "../pings.txt"
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
+)
+
+// SetBackend sets the backend starting the instances of the node, and
+// relaunches the crashed instances if the backend can detect crashes
+func (s *Service) SetBackend(b InstanceBackend) {
+	s.Backend = b
+	if n, ok := b.(CrashNotifier); ok {
+		n.SetCrashHandler(s.instanceCrashed)
+	}
+}
+
+// Crashes returns the crash events of the instances of the node
+func (s *Service) Crashes() []CrashEvent {
+	s.crashMutex.Lock()
+	defer s.crashMutex.Unlock()
+	return append([]CrashEvent{}, s.crashes...)
+}
+
+// instanceCrashed relaunches a crashed instance with its repo and identity,
+// and records the crash event. A cluster peer is bootstrapped to a live
+// member of its ARA.
+func (s *Service) instanceCrashed(i *Instance, err error) {
+	if !s.ownsInstance(i) {
+		// stopped in the meantime
+		return
+	}
+	e := CrashEvent{
+		Node:     i.Node,
+		Kind:     i.Kind,
+		Secret:   i.Secret,
+		Path:     i.Path,
+		Time:     time.Now().UnixNano() / int64(time.Millisecond),
+		Downtime: -1,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	s.crashMutex.Lock()
+	if s.restarts == nil {
+		s.restarts = make(map[string]int)
+	}
+	s.restarts[i.Path]++
+	restarts := s.restarts[i.Path]
+	s.crashMutex.Unlock()
+
+	if restarts <= MaxInstanceRestarts {
+		e.Bootstrap, e.Attempts, e.Recovered = s.relaunch(i)
+		if e.Recovered {
+			e.Downtime = time.Now().UnixNano()/int64(time.Millisecond) - e.Time
+			monitor.RecordSingleMeasure("crash_downtime",
+				float64(e.Downtime)/1000)
+		}
+	} else {
+		log.Error(s.Name, "gave up relaunching", i.Kind, "instance at", i.Path,
+			"after", MaxInstanceRestarts, "restarts")
+	}
+
+	s.crashMutex.Lock()
+	s.crashes = append(s.crashes, e)
+	s.crashMutex.Unlock()
+}
+
+// DefaultRelaunchPolicy returns the relaunch policy of the crashed instances
+// when nothing else is specified
+func DefaultRelaunchPolicy() RelaunchPolicy {
+	return RelaunchPolicy{
+		Attempts: DefaultRelaunchAttempts,
+		Backoff:  RestartDelay,
+	}
+}
+
+// relaunch restarts the instance from its repo, retrying with the backoff of
+// the relaunch policy while it does not start or is not ready, and returns
+// the address the instance bootstrapped to, the number of attempts and true
+// if it is ready again
+func (s *Service) relaunch(i *Instance) (string, int, bool) {
+	attempts := s.Relaunch.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := s.Relaunch.Backoff
+	timeout := IPFSStartupTime
+	if i.Kind == ClusterKind {
+		timeout = ClusterStartupTime
+	}
+
+	var bootstrap string
+	for a := 1; a <= attempts; a++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		if i.Kind == ClusterKind {
+			// a raft peer leaves its stale peer set and rejoins through
+			// the bootstrap, as a crdt peer
+			bootstrap = s.liveBootstrap(i)
+			s.InstancesMutex.Lock()
+			i.Bootstrap = bootstrap
+			s.InstancesMutex.Unlock()
+		}
+
+		log.Lvl1(s.Name, "relaunching", i.Kind, "instance at", i.Path,
+			"attempt", a)
+		if err := s.Backend.Start(i); err != nil {
+			log.Error(s.Name, "failed to relaunch", i.Kind, "instance:", err)
+			continue
+		}
+		if err := s.waitReady(i, timeout); err != nil {
+			log.Error(err)
+			if err := s.Backend.Stop(i); err != nil {
+				log.Lvl2(err)
+			}
+			continue
+		}
+		s.saveState()
+		return bootstrap, a, true
+	}
+	return bootstrap, attempts, false
+}
+
+// liveBootstrap returns the address of a reachable peer of the ARA of the
+// given cluster instance, taken from its peerstore, or its previous bootstrap
+// address if none answers
+func (s *Service) liveBootstrap(i *Instance) string {
+	s.InstancesMutex.Lock()
+	previous := i.Bootstrap
+	s.InstancesMutex.Unlock()
+	addrs, err := ReadClusterPeerstore(i.Path)
+	if err != nil {
+		log.Lvl2(err)
+		return previous
+	}
+	for _, a := range addrs {
+		if i.PeerID != "" && strings.HasSuffix(a, i.PeerID) {
+			continue
+		}
+		if reachable(a) {
+			return a
+		}
+	}
+	return previous
+}
+
+// ownsInstance returns true if the instance is owned by the node
+func (s *Service) ownsInstance(i *Instance) bool {
+	s.InstancesMutex.Lock()
+	defer s.InstancesMutex.Unlock()
+	for _, o := range s.Instances {
+		if o == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,431 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// ExecBackend InstanceBackend running the ipfs and ipfs-cluster-service
+// binaries
+type ExecBackend struct {
+	mutex   sync.Mutex
+	daemons map[string]*daemon // repo path -> running daemon
+	client  *http.Client       // readiness checks
+	api     *http.Client       // health checks
+	crashed func(i *Instance, err error)
+}
+
+// daemon process started by the ExecBackend
+type daemon struct {
+	cmd  *exec.Cmd
+	done chan struct{} // closed when the process exits
+}
+
+// Check that *ExecBackend implements InstanceBackend, HealthChecker and
+// CrashNotifier
+var _ InstanceBackend = (*ExecBackend)(nil)
+var _ HealthChecker = (*ExecBackend)(nil)
+var _ CrashNotifier = (*ExecBackend)(nil)
+
+// NewExecBackend creates a new ExecBackend
+func NewExecBackend() *ExecBackend {
+	return &ExecBackend{
+		daemons: make(map[string]*daemon),
+		client:  &http.Client{Timeout: ReadyPollInterval},
+		api:     &http.Client{Timeout: HealthRequestTimeout},
+	}
+}
+
+// Init creates the ipfs repo or the cluster configuration
+func (b *ExecBackend) Init(i *Instance) error {
+	if i.Kind == ClusterKind {
+		err := InitClusterConfig(i.Path, i.Node, i.Secret, i.IPFSAPIAddr,
+			*i.Cluster, i.Profile)
+		if err != nil {
+			return err
+		}
+		id, err := ReadClusterIdentity(i.Path)
+		if err != nil {
+			return err
+		}
+		i.PeerID = id.ID
+		return nil
+	}
+	o, err := exec.Command("ipfs", "-c", i.Path, "init").CombinedOutput()
+	if err != nil {
+		log.Lvl1(string(o))
+		return err
+	}
+	i.PeerID, err = IPFSPeerID(i.Path)
+	if err != nil {
+		return err
+	}
+	// edit the ip in the config file
+	return ApplyIPFSProfile(i.Path, i.IPFSProfile)
+}
+
+// Start launches the daemon of the instance
+func (b *ExecBackend) Start(i *Instance) error {
+	var cmd *exec.Cmd
+	if i.Kind == ClusterKind {
+		args := []string{"-c", i.Path, "daemon"}
+		if i.Bootstrap != "" {
+			args = append(args, "--bootstrap", i.Bootstrap)
+		}
+		args = append(args, i.Profile.DaemonArgs()...)
+		cmd = exec.Command("ipfs-cluster-service", args...)
+		// log the raft state changes, read by Health to find the leader
+		cmd.Env = append(os.Environ(), "IPFS_LOGGING=info")
+		logFile, err := os.OpenFile(filepath.Join(i.Path, ClusterLogFile),
+			os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	} else {
+		cmd = exec.Command("ipfs", "-c", i.Path, "daemon")
+		if i.IPFSProfile.SwarmKey != "" {
+			// refuse to start without the private network key
+			cmd.Env = append(os.Environ(), "LIBP2P_FORCE_PNET=1")
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.daemons[i.Path]; ok {
+		return errors.New(i.Kind.String() + " instance already running at " +
+			i.Path)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	d := &daemon{cmd: cmd, done: make(chan struct{})}
+	b.daemons[i.Path] = d
+
+	go func() {
+		err := cmd.Wait()
+		close(d.done)
+		b.mutex.Lock()
+		stopped := b.daemons[i.Path] != d
+		if !stopped {
+			delete(b.daemons, i.Path)
+		}
+		crashed := b.crashed
+		b.mutex.Unlock()
+		if stopped {
+			return
+		}
+		log.Lvl1(i.Kind.String(), "instance of", i.Node, "crashed:", err)
+		if crashed != nil {
+			crashed(i, err)
+		}
+	}()
+	return nil
+}
+
+// SetCrashHandler sets the function called when a daemon exits without
+// being stopped
+func (b *ExecBackend) SetCrashHandler(f func(i *Instance, err error)) {
+	b.mutex.Lock()
+	b.crashed = f
+	b.mutex.Unlock()
+}
+
+// Stop interrupts the daemon of the instance, and kills it if it is still
+// running after InstanceStopTimeout
+func (b *ExecBackend) Stop(i *Instance) error {
+	b.mutex.Lock()
+	d, ok := b.daemons[i.Path]
+	delete(b.daemons, i.Path)
+	b.mutex.Unlock()
+	if !ok {
+		return errors.New("no " + i.Kind.String() + " instance running at " +
+			i.Path)
+	}
+
+	if err := d.cmd.Process.Signal(os.Interrupt); err != nil {
+		return d.cmd.Process.Kill()
+	}
+	select {
+	case <-d.done:
+		return nil
+	case <-time.After(InstanceStopTimeout):
+		return d.cmd.Process.Kill()
+	}
+}
+
+// APIAddr returns the IPFS API or the cluster REST API multiaddress
+func (b *ExecBackend) APIAddr(i *Instance) string {
+	if i.Kind == ClusterKind {
+		return clusterAPIAddr(i.Cluster)
+	}
+	return i.IPFSProfile.APIAddr
+}
+
+// Ready returns true if the instance answers on its API
+func (b *ExecBackend) Ready(i *Instance) bool {
+	addr, err := HTTPAddr(b.APIAddr(i))
+	if err != nil {
+		return false
+	}
+	var resp *http.Response
+	if i.Kind == ClusterKind {
+		resp, err = b.client.Get("http://" + addr + "/id")
+	} else {
+		resp, err = b.client.Post("http://"+addr+"/api/v0/id", "", nil)
+	}
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Health queries the peers and the pins of the instance on its API
+func (b *ExecBackend) Health(i *Instance) InstanceHealth {
+	h := InstanceHealth{Ready: b.Ready(i)}
+	if !h.Ready {
+		return h
+	}
+	addr, err := HTTPAddr(b.APIAddr(i))
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+
+	if i.Kind == ClusterKind {
+		peers := make([]struct {
+			ID    string `json:"id"`
+			Error string `json:"error"`
+		}, 0)
+		if err := b.apiRequest(http.MethodGet, "http://"+addr+"/peers",
+			&peers); err != nil {
+			h.Error = err.Error()
+			return h
+		}
+		for _, p := range peers {
+			if p.Error == "" {
+				h.Peers++
+			}
+		}
+		var id struct {
+			ClusterPeers []string `json:"cluster_peers"`
+			Error        string   `json:"error"`
+		}
+		if err := b.apiRequest(http.MethodGet, "http://"+addr+"/id",
+			&id); err != nil {
+			h.Error = err.Error()
+			return h
+		}
+		if id.Error != "" {
+			h.Error = id.Error
+			return h
+		}
+		h.ConsensusPeers = len(id.ClusterPeers)
+		if i.Profile != nil && i.Profile.Consensus == "raft" {
+			h.Leader = readRaftLeader(i)
+		}
+		pins := make([]json.RawMessage, 0)
+		if err := b.apiRequest(http.MethodGet,
+			"http://"+addr+"/allocations?filter=all", &pins); err != nil {
+			h.Error = err.Error()
+			return h
+		}
+		h.Pins = len(pins)
+		return h
+	}
+
+	var peers struct{ Peers []json.RawMessage }
+	if err := b.apiRequest(http.MethodPost,
+		"http://"+addr+"/api/v0/swarm/peers", &peers); err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.Peers = len(peers.Peers)
+	var pins struct{ Keys map[string]json.RawMessage }
+	if err := b.apiRequest(http.MethodPost,
+		"http://"+addr+"/api/v0/pin/ls?type=recursive", &pins); err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.Pins = len(pins.Keys)
+	return h
+}
+
+// readRaftLeader returns the raft leader seen by the cluster peer, read from
+// its daemon log as the raft leader is not exposed by the REST API
+func readRaftLeader(i *Instance) string {
+	f, err := os.Open(filepath.Join(i.Path, ClusterLogFile))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return raftLeader(f, i.PeerID)
+}
+
+// raftLeader returns the last raft leader logged by the cluster peer with the
+// given peer id, or an empty string if the peer does not know its leader
+func raftLeader(r io.Reader, self string) string {
+	leader := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.Contains(line, "entering Leader state"):
+			leader = self
+		case strings.Contains(line, "entering Candidate state"):
+			leader = ""
+		case strings.Contains(line, "entering Follower state"):
+			// the leader is usually unknown yet when entering this state
+			leader = ""
+			parts := strings.SplitN(line, "(Leader: \"", 2)
+			if len(parts) == 2 {
+				leader = strings.SplitN(parts[1], "\"", 2)[0]
+			}
+		case strings.Contains(line, "Current Raft Leader: "):
+			parts := strings.SplitN(line, "Current Raft Leader: ", 2)
+			if fields := strings.Fields(parts[1]); len(fields) > 0 {
+				leader = fields[0]
+			}
+		}
+	}
+	return leader
+}
+
+// apiRequest sends a request to an instance API and decodes the JSON answer
+func (b *ExecBackend) apiRequest(method, url string, v interface{}) error {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.api.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(url + ": " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// MemoryUsage returns the resident memory of the daemon in KiB, read from
+// /proc
+func (b *ExecBackend) MemoryUsage(i *Instance) (uint64, error) {
+	b.mutex.Lock()
+	d, ok := b.daemons[i.Path]
+	b.mutex.Unlock()
+	if !ok {
+		return 0, errors.New("no " + i.Kind.String() + " instance running at " +
+			i.Path)
+	}
+
+	status, err := ioutil.ReadFile(filepath.Join("/proc",
+		strconv.Itoa(d.cmd.Process.Pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	// VmRSS:	   12345 kB
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "VmRSS:") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				break
+			}
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, errors.New("no resident memory found for " + i.Path)
+}
+
+// Adopt takes control of a daemon running the repo of the instance that was
+// not started by this backend, e.g. before the conode restarted
+func (b *ExecBackend) Adopt(i *Instance) error {
+	pid, err := findDaemon(i.Path)
+	if err != nil {
+		return err
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.daemons[i.Path]; ok {
+		return errors.New(i.Kind.String() + " instance already running at " +
+			i.Path)
+	}
+	d := &daemon{cmd: &exec.Cmd{Process: p}, done: make(chan struct{})}
+	b.daemons[i.Path] = d
+
+	// the process is not a child, poll it until it exits
+	go func() {
+		for p.Signal(syscall.Signal(0)) == nil {
+			time.Sleep(ReadyPollInterval)
+		}
+		close(d.done)
+		b.mutex.Lock()
+		stopped := b.daemons[i.Path] != d
+		if !stopped {
+			delete(b.daemons, i.Path)
+		}
+		crashed := b.crashed
+		b.mutex.Unlock()
+		if !stopped && crashed != nil {
+			crashed(i, errors.New("adopted process exited"))
+		}
+	}()
+	return nil
+}
+
+// findDaemon returns the pid of the daemon process running the repo at the
+// given path
+func findDaemon(path string) (int, error) {
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", p.Name(),
+			"cmdline"))
+		if err != nil {
+			continue
+		}
+		// ipfs -c <path> daemon, ipfs-cluster-service -c <path> daemon ...
+		args := strings.Split(string(cmdline), "\x00")
+		repo, isDaemon := false, false
+		for n, a := range args {
+			if a == "daemon" {
+				isDaemon = true
+			}
+			if a == "-c" && n+1 < len(args) && args[n+1] == path {
+				repo = true
+			}
+		}
+		if repo && isDaemon {
+			return pid, nil
+		}
+	}
+	return 0, errors.New("no daemon found for " + path)
+}
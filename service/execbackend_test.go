@@ -0,0 +1,29 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRaftLeader(t *testing.T) {
+	self := "QmSelf"
+	for log, expected := range map[string]string{
+		"": "",
+		"raftlib: Node at QmSelf [Follower] entering Follower state " +
+			"(Leader: \"\")\n" +
+			"raft: Current Raft Leader: QmOther raft.go:264\n": "QmOther",
+		"raft: Current Raft Leader: QmOther\n" +
+			"raftlib: Node at QmSelf [Candidate] entering Candidate state " +
+			"in term 3\n": "",
+		"raftlib: Node at QmSelf [Candidate] entering Candidate state " +
+			"in term 3\n" +
+			"raftlib: Node at QmSelf [Leader] entering Leader state\n": self,
+		"raftlib: Node at QmSelf [Follower] entering Follower state " +
+			"(Leader: \"QmOther\")\n": "QmOther",
+	} {
+		if leader := raftLeader(strings.NewReader(log), self); leader !=
+			expected {
+			t.Fatal("leader", leader, "instead of", expected, "in", log)
+		}
+	}
+}
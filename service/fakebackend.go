@@ -0,0 +1,250 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// FakeBackend InstanceBackend simulating IPFS and IPFS Cluster instances in
+// memory. Content added to an instance can be read from every started
+// instance of the same ARA (i.e. sharing the same secret). The first started
+// cluster peer of an ARA is its leader, a new one is elected when it stops.
+type FakeBackend struct {
+	mutex     sync.Mutex
+	instances map[string]*fakeInstance       // repo path -> instance
+	content   map[string]map[string][]byte   // ARA secret -> cid -> data
+	pins      map[string]map[string][]string // ARA secret -> cid -> nodes
+	stalled   map[string]chan struct{}       // node -> closed on release
+	leaders   map[string]*Instance           // ARA secret -> leader peer
+}
+
+// fakeInstance state of a simulated instance
+type fakeInstance struct {
+	instance *Instance
+	started  bool
+}
+
+// Check that *FakeBackend implements InstanceBackend and HealthChecker
+var _ InstanceBackend = (*FakeBackend)(nil)
+var _ HealthChecker = (*FakeBackend)(nil)
+
+// NewFakeBackend creates a new FakeBackend
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		instances: make(map[string]*fakeInstance),
+		content:   make(map[string]map[string][]byte),
+		pins:      make(map[string]map[string][]string),
+		stalled:   make(map[string]chan struct{}),
+		leaders:   make(map[string]*Instance),
+	}
+}
+
+// Stall blocks the Start, Stop and Health calls for the instances of the
+// given node, e.g. to simulate a hanging node, until release is called
+func (b *FakeBackend) Stall(node string) (release func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	c := make(chan struct{})
+	b.stalled[node] = c
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.stalled, node)
+		close(c)
+	}
+}
+
+// wait blocks while the node of the instance is stalled
+func (b *FakeBackend) wait(i *Instance) {
+	b.mutex.Lock()
+	c, ok := b.stalled[i.Node]
+	b.mutex.Unlock()
+	if ok {
+		<-c
+	}
+}
+
+// Init registers the instance
+func (b *FakeBackend) Init(i *Instance) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.instances[i.Path]; ok {
+		return errors.New("instance already initialized at " + i.Path)
+	}
+	h := sha256.Sum256([]byte(i.Path))
+	i.PeerID = "fake" + hex.EncodeToString(h[:8])
+	b.instances[i.Path] = &fakeInstance{instance: i}
+	return nil
+}
+
+// Start marks the instance as started
+func (b *FakeBackend) Start(i *Instance) error {
+	b.wait(i)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	fi, ok := b.instances[i.Path]
+	if !ok {
+		return errors.New("no instance initialized at " + i.Path)
+	}
+	if fi.started {
+		return errors.New("instance already running at " + i.Path)
+	}
+	fi.started = true
+	if i.Kind == ClusterKind && b.leaders[i.Secret] == nil {
+		b.leaders[i.Secret] = i
+	}
+	return nil
+}
+
+// Stop marks the instance as stopped
+func (b *FakeBackend) Stop(i *Instance) error {
+	b.wait(i)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	fi, ok := b.instances[i.Path]
+	if !ok || !fi.started {
+		return errors.New("no instance running at " + i.Path)
+	}
+	fi.started = false
+	if b.leaders[i.Secret] == i {
+		b.elect(i.Secret)
+	}
+	return nil
+}
+
+// elect sets the started cluster peer of the ARA with the smallest repo path
+// as its leader, the mutex must be held by the caller
+func (b *FakeBackend) elect(secret string) {
+	b.leaders[secret] = nil
+	for path, fi := range b.instances {
+		if !fi.started || fi.instance.Kind != ClusterKind ||
+			fi.instance.Secret != secret {
+			continue
+		}
+		if l := b.leaders[secret]; l == nil || path < l.Path {
+			b.leaders[secret] = fi.instance
+		}
+	}
+}
+
+// APIAddr returns the IPFS API or the cluster REST API multiaddress
+func (b *FakeBackend) APIAddr(i *Instance) string {
+	if i.Kind == ClusterKind {
+		return clusterAPIAddr(i.Cluster)
+	}
+	return i.IPFSProfile.APIAddr
+}
+
+// Ready returns true if the instance is started
+func (b *FakeBackend) Ready(i *Instance) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	fi, ok := b.instances[i.Path]
+	return ok && fi.started
+}
+
+// Health returns the number of started instances of the same kind in the ARA
+// of the instance, and the number of cids pinned on the instance's node. The
+// cluster peers see all started peers as consensus peers, and the same leader.
+func (b *FakeBackend) Health(i *Instance) InstanceHealth {
+	b.wait(i)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	h := InstanceHealth{}
+	if b.checkStarted(i) != nil {
+		return h
+	}
+	h.Ready = true
+	for _, fi := range b.instances {
+		if fi.started && fi.instance.Kind == i.Kind &&
+			fi.instance.Secret == i.Secret {
+			h.Peers++
+		}
+	}
+	if i.Kind == IPFSKind {
+		// ipfs instances don't count themselves as peers
+		h.Peers--
+	} else {
+		h.ConsensusPeers = h.Peers
+		h.Leader = b.leaders[i.Secret].PeerID
+	}
+	for _, nodes := range b.pins[i.Secret] {
+		for _, n := range nodes {
+			if n == i.Node {
+				h.Pins++
+				break
+			}
+		}
+	}
+	return h
+}
+
+// Add adds the data to the ARA of the given instance, pins it on the
+// instance's node and returns its cid
+func (b *FakeBackend) Add(i *Instance, data []byte) (string, error) {
+	h := sha256.Sum256(data)
+	cid := "fake" + hex.EncodeToString(h[:])
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.checkStarted(i); err != nil {
+		return "", err
+	}
+	if _, ok := b.content[i.Secret]; !ok {
+		b.content[i.Secret] = make(map[string][]byte)
+		b.pins[i.Secret] = make(map[string][]string)
+	}
+	b.content[i.Secret][cid] = data
+	b.pins[i.Secret][cid] = append(b.pins[i.Secret][cid], i.Node)
+	return cid, nil
+}
+
+// Pin pins the given cid on the instance's node, the content must have been
+// added to the ARA of the instance
+func (b *FakeBackend) Pin(i *Instance, cid string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.checkStarted(i); err != nil {
+		return err
+	}
+	if _, ok := b.content[i.Secret][cid]; !ok {
+		return errors.New(cid + " not found in the ARA of " + i.Node)
+	}
+	b.pins[i.Secret][cid] = append(b.pins[i.Secret][cid], i.Node)
+	return nil
+}
+
+// Cat returns the content of the given cid, if it was added to the ARA of
+// the instance
+func (b *FakeBackend) Cat(i *Instance, cid string) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.checkStarted(i); err != nil {
+		return nil, err
+	}
+	data, ok := b.content[i.Secret][cid]
+	if !ok {
+		return nil, errors.New(cid + " not found in the ARA of " + i.Node)
+	}
+	return data, nil
+}
+
+// Pins returns the nodes where the given cid is pinned in the ARA of the
+// instance
+func (b *FakeBackend) Pins(i *Instance, cid string) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string{}, b.pins[i.Secret][cid]...)
+}
+
+// checkStarted returns an error if the instance is not started, the mutex
+// must be held by the caller
+func (b *FakeBackend) checkStarted(i *Instance) error {
+	fi, ok := b.instances[i.Path]
+	if !ok || !fi.started {
+		return errors.New("no instance running at " + i.Path)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
+)
+
+// Check that *HealthProtocol implements onet.ProtocolInstance
+var _ onet.ProtocolInstance = (*HealthProtocol)(nil)
+
+// NewHealthProtocol initialises the structure for use in one round
+func NewHealthProtocol(n *onet.TreeNodeInstance, getServ FnService) (
+	onet.ProtocolInstance, error) {
+	t := &HealthProtocol{
+		TreeNodeInstance: n,
+		Ready:            make(chan bool),
+		GetService:       getServ,
+		Timeout:          ProtocolTimeout,
+	}
+	if err := n.RegisterChannels(&t.announceChan, &t.repliesChan); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Start sends the Announce-message to all children
+func (p *HealthProtocol) Start() error {
+	log.Lvl2("Collecting the health of the ARAs")
+	return p.SendTo(p.TreeNode(), &HealthAnnounce{Timeout: p.Timeout})
+}
+
+// Dispatch implements the main logic of the protocol. The function is only
+// called once. The protocol is considered finished when Dispatch returns and
+// Done is called.
+func (p *HealthProtocol) Dispatch() error {
+	defer p.Done()
+
+	s := p.GetService()
+	var ann announceWrapperHealth
+	select {
+	case ann = <-p.announceChan:
+	case <-time.After(p.Timeout):
+		return errors.New(s.Name + " got no " + HealthName +
+			" announce after " + p.Timeout.String())
+	}
+	p.Timeout = ann.Timeout
+	deadline := time.Now().Add(p.Timeout)
+	round := monitor.NewTimeMeasure(roundMeasurePrefix + HealthName)
+
+	nodes := make([]NodeHealth, 0)
+	if !p.IsLeaf() {
+		// send request to children
+		fwd := ann.HealthAnnounce
+		fwd.Timeout = levelTimeout(deadline, subtreeHeight(p.TreeNode()))
+		p.SendToChildren(&fwd)
+	}
+
+	// query own instances while the children are querying theirs
+	nodes = append(nodes, s.localHealth())
+
+	if !p.IsLeaf() {
+		// wait for children replies
+		replied := make(map[onet.TreeNodeID]bool)
+		timeout := time.After(time.Until(deadline))
+	wait:
+		for len(replied) < len(p.Children()) {
+			select {
+			case r := <-p.repliesChan:
+				replied[r.TreeNode.ID] = true
+				nodes = append(nodes, r.Nodes...)
+			case <-timeout:
+				for _, st := range s.missingStatus(p.TreeNodeInstance, replied,
+					p.Timeout) {
+					nodes = append(nodes, NodeHealth{Name: st.Name,
+						Error: st.Errors[0]})
+				}
+				break wait
+			}
+		}
+	}
+
+	if !p.IsRoot() {
+		return p.SendToParent(&HealthReply{Nodes: nodes})
+	}
+
+	// root
+	p.Report = aggregateHealth(nodes)
+	p.Healthy = len(p.Report) > 0
+	for _, n := range nodes {
+		if n.Error != "" {
+			p.Healthy = false
+			log.Lvl2("Health of", n.Name, "unknown:", n.Error)
+		}
+	}
+	for _, a := range p.Report {
+		if a.FailedRelaunches > 0 {
+			log.Lvl2("ARA of", a.Leader, "had", a.Crashes, "crashes,",
+				a.FailedRelaunches, "relaunches failed")
+		}
+		if !a.Healthy {
+			p.Healthy = false
+			log.Lvl2("ARA of", a.Leader, "not formed:", a.ReadyPeers, "/",
+				a.Size, "peers ready, unreachable:", a.Unreachable,
+				"raft leaders:", a.RaftLeaders, a.Errors)
+		}
+	}
+	log.Lvl2("Health of", len(p.Report), "ARAs collected, healthy:", p.Healthy)
+	round.Record()
+	p.Ready <- true
+	return nil
+}
+
+// localHealth queries the API of all instances owned by the node
+func (s *Service) localHealth() NodeHealth {
+	h := NodeHealth{
+		Name:      s.Name,
+		Instances: make([]InstanceHealth, 0),
+		Crashes:   s.Crashes(),
+		Progress:  s.Progress(),
+	}
+	checker, canCheck := s.Backend.(HealthChecker)
+
+	s.InstancesMutex.Lock()
+	instances := append([]*Instance{}, s.Instances...)
+	h.ARAs = append([]ClusterInfo{}, s.ARAs...)
+	s.InstancesMutex.Unlock()
+
+	for _, i := range instances {
+		var ih InstanceHealth
+		if canCheck {
+			ih = checker.Health(i)
+		} else {
+			ih = InstanceHealth{Ready: s.Backend.Ready(i)}
+		}
+		ih.Kind = i.Kind
+		ih.Node = i.Node
+		ih.Secret = i.Secret
+		ih.PeerID = i.PeerID
+		h.Instances = append(h.Instances, ih)
+	}
+	return h
+}
+
+// aggregateHealth groups the instance reports of all nodes by ARA. An ARA is
+// healthy if the cluster peers of all its members are ready and each of them
+// sees the whole ARA as its peer set. A raft ARA must also have the whole ARA
+// as consensus peer set on every peer, and a single leader seen by its peers.
+func aggregateHealth(nodes []NodeHealth) map[string]*ARAHealth {
+	report := make(map[string]*ARAHealth)
+	for _, n := range nodes {
+		for _, a := range n.ARAs {
+			size := a.Members
+			if size == 0 {
+				// ARA started before the members were counted
+				size = a.Size
+			}
+			report[a.Secret] = &ARAHealth{
+				Leader:      a.Leader,
+				Secret:      a.Secret,
+				Consensus:   a.Profile.Consensus,
+				Size:        size,
+				MinPeers:    size,
+				Unreachable: make([]string, 0),
+				Errors:      make([]string, 0),
+
+				ConsensusPeers: size,
+				RaftLeaders:    make([]string, 0),
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		for _, i := range n.Instances {
+			a, ok := report[i.Secret]
+			if !ok {
+				// shared ipfs instance, or ARA whose root did not answer
+				continue
+			}
+			if i.Error != "" {
+				a.Errors = append(a.Errors, i.Node+": "+i.Error)
+			}
+			if i.Kind == IPFSKind {
+				if i.Ready {
+					a.ReadyIPFS++
+				}
+				continue
+			}
+			if !i.Ready {
+				a.Unreachable = append(a.Unreachable, i.Node)
+				continue
+			}
+			a.ReadyPeers++
+			if i.Peers < a.MinPeers {
+				a.MinPeers = i.Peers
+			}
+			if i.Pins > a.Pins {
+				a.Pins = i.Pins
+			}
+			if i.ConsensusPeers < a.ConsensusPeers {
+				a.ConsensusPeers = i.ConsensusPeers
+			}
+			if i.Leader != "" && !contains(a.RaftLeaders, i.Leader) {
+				a.RaftLeaders = append(a.RaftLeaders, i.Leader)
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		for _, c := range n.Crashes {
+			a, ok := report[c.Secret]
+			if !ok {
+				continue
+			}
+			a.Crashes++
+			a.FailedRelaunches += c.Attempts
+			if c.Recovered {
+				// the last attempt succeeded
+				a.FailedRelaunches--
+			}
+		}
+		for _, p := range n.Progress {
+			if a, ok := report[p.Secret]; ok {
+				a.Starting += p.Started
+				a.Failed += p.Failed
+			}
+		}
+	}
+
+	for _, a := range report {
+		sort.Strings(a.Unreachable)
+		sort.Strings(a.RaftLeaders)
+		a.Healthy = a.ReadyPeers == a.Size && a.MinPeers >= a.Size
+		if a.Consensus == "raft" {
+			a.Healthy = a.Healthy && a.ConsensusPeers >= a.Size &&
+				len(a.RaftLeaders) == 1
+		}
+	}
+	return report
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestAggregateHealthLeaders(t *testing.T) {
+	nodes := func(consensus string, leaders ...string) []NodeHealth {
+		n := NodeHealth{
+			Name: Node0,
+			ARAs: []ClusterInfo{{
+				Leader:  Node0,
+				Secret:  "ara",
+				Members: len(leaders),
+				Profile: ClusterProfile{Consensus: consensus},
+			}},
+		}
+		for _, l := range leaders {
+			n.Instances = append(n.Instances, InstanceHealth{
+				Kind:           ClusterKind,
+				Secret:         "ara",
+				Ready:          true,
+				Peers:          len(leaders),
+				ConsensusPeers: len(leaders),
+				Leader:         l,
+			})
+		}
+		return []NodeHealth{n}
+	}
+
+	for _, c := range []struct {
+		nodes   []NodeHealth
+		healthy bool
+	}{
+		{nodes("raft", "QmA", "QmA", ""), true},
+		{nodes("raft", "", "", ""), false},
+		{nodes("raft", "QmA", "QmB", "QmA"), false},
+		{nodes("crdt", "", "", ""), true},
+	} {
+		a := aggregateHealth(c.nodes)["ara"]
+		if a.Healthy != c.healthy {
+			t.Fatal(a.Consensus, "ARA with leaders", a.RaftLeaders,
+				"healthy:", a.Healthy)
+		}
+	}
+
+	// a peer that lost part of its consensus peer set breaks a raft ARA
+	n := nodes("raft", "QmA", "QmA", "QmA")
+	n[0].Instances[1].ConsensusPeers = 2
+	if a := aggregateHealth(n)["ara"]; a.Healthy || a.ConsensusPeers != 2 {
+		t.Fatal("ARA healthy with", a.ConsensusPeers, "consensus peers")
+	}
+}
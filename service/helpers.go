@@ -67,6 +67,26 @@ func GetNextAvailablePorts(pmin, pmax, n int) (*[]int, error) {
 	return &ret, nil
 }
 
+// GetUsedPorts returns the tcp and udp ports the node is listening on or
+// connected from
+func GetUsedPorts() (map[int]bool, error) {
+	cmd := "ss -tuan | awk '{print $5}' | rev | cut -d':' -f1 | rev | " +
+		"grep '^[0-9]\\{1,5\\}$' | sort -u"
+	out, err := exec.Command("bash", "-c", cmd).Output()
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[int]bool)
+	for _, s := range strings.Fields(string(out)) {
+		p, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.New("cannot parse used ports")
+		}
+		used[p] = true
+	}
+	return used, nil
+}
+
 // ReadConfig read a config file given as parameter and returns a string
 func ReadConfig(file string) (string, error) {
 	dat, err := ioutil.ReadFile(file)
@@ -133,3 +153,13 @@ func ReadFileLineByLine(configFilePath string) func() string {
 		return line
 	}
 }
+
+// contains returns true if the list contains the string
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
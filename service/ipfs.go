@@ -1,330 +1,243 @@
 package service
 
 import (
-	"crypto/rand"
-	"encoding/hex"
-	"errors"
-	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
-	"time"
 
 	"go.dedis.ch/onet/v3/log"
 )
 
 // setIPFSVariables set service variables useful for IPFS and config folders
-func (s *Service) setIPFSVariables() {
+func (s *Service) setIPFSVariables() error {
 	// get config path
 	// e.g $GOPATH/src/github.com/dedis/student_19_cruxIPFS/simulation/build
 	pwd, err := os.Getwd()
-	checkErr(err)
+	if err != nil {
+		return err
+	}
 	//pwd := "/users/guissou"
 	configPath := filepath.Join(pwd, ConfigsFolder)
 
 	// set the port range allocated to s
-	s.MinPort = BaseHostPort + s.getNodeID()*MaxPortNumberPerHost
+	id, err := s.getNodeID()
+	if err != nil {
+		return err
+	}
+	s.MinPort = BaseHostPort + id*MaxPortNumberPerHost
 	s.MaxPort = s.MinPort + MaxPortNumberPerHost
 
 	s.ConfigPath = filepath.Join(configPath, s.Name)
-	checkErr(CreateEmptyDir(s.ConfigPath))
 
 	// create own config home folder and ipfs config folder
 	s.MyIPFSPath = filepath.Join(s.ConfigPath, IPFSFolder)
 
+	if s.recovered {
+		// keep the repos of the recovered instances
+		return nil
+	}
+	if err := CreateEmptyDir(s.ConfigPath); err != nil {
+		return err
+	}
 	s.MyIPFS = make([]IPFSInformation, 0)
+	return nil
 }
 
 // StartIPFS starts an IPFS instance for the given service
 // return the multiaddress of the IPFS API
-func (s *Service) StartIPFS(secret string) string {
-	path := s.MyIPFSPath + "-" + secret
-	checkErr(CreateEmptyDir(path))
-
-	cmd := "ipfs -c" + path + " init"
-	ou, err := exec.Command("bash", "-c", cmd).Output()
+func (s *Service) StartIPFS(secret string) (string, error) {
+	i, err := s.startIPFS(secret, nil)
 	if err != nil {
-		log.Lvl1(string(ou))
-		log.Error(err)
-	}
-
-	s.PortMutex.Lock()
-	// edit the ip in the config file
-	ipfsAPI := s.EditIPFSConfig(path)
-
-	// start ipfs daemon
-	go func() {
-		cmd := "ipfs -c" + path + " daemon"
-		o, err := exec.Command("bash", "-c", cmd).Output()
-		fmt.Println("ipfs at ip", s.Name, "crashed")
-		fmt.Println(cmd)
-		fmt.Println(string(o))
-		fmt.Println(err)
-	}()
-	// wait until it has started
-	time.Sleep(IPFSStartupTime)
-	s.PortMutex.Unlock()
-	return ipfsAPI
+		return "", err
+	}
+	return s.Backend.APIAddr(i), nil
 }
 
-// EditIPFSConfig edit the ipfs configuration file (mainly the ip)
-// returns the API address of the IPFS instance
-func (s *Service) EditIPFSConfig(path string) string {
-	addr := IPVersion + s.MyIP + TransportProtocol
-
-	// select available ports
-	ports, err := GetNextAvailablePorts(s.MinPort, s.MaxPort, IPFSPortNumber)
-	checkErr(err)
-
-	// [\"/ip4/0.0.0.0/tcp/5001\", \"/ip6/::/tcp/5001\"]
-	//swarmList := []string{addr + SwarmPort}
-	Swarm := MakeJSONArray([]string{addr +
-		strconv.Itoa((*ports)[0])})
-
-	// /ip4/127.0.0.1/tcp/5001
-	API := MakeJSONElem(addr + strconv.Itoa((*ports)[1]))
-	// /ip4/127.0.0.1/tcp/8080
-	Gateway := MakeJSONElem(addr + strconv.Itoa((*ports)[2]))
+// startIPFS starts an IPFS instance for the ARA with the given secret. If
+// private networks are enabled, the instance only accepts peers of the ARA
+// and bootstraps to the given ARA members.
+func (s *Service) startIPFS(secret string, bootstrap []string) (*Instance,
+	error) {
 
-	EditIPFSField(path, "Addresses.API", API)
-	EditIPFSField(path, "Addresses.Gateway", Gateway)
-	EditIPFSField(path, "Addresses.Swarm", Swarm)
+	if s.setupErr != nil {
+		return nil, s.setupErr
+	}
 
-	// filling my IPFS info
-	s.MyIPFS = append(s.MyIPFS, IPFSInformation{
-		Name:        s.Name,
-		IP:          s.MyIP,
-		SwarmPort:   (*ports)[0],
-		APIPort:     (*ports)[1],
-		GatewayPort: (*ports)[2],
-	})
-	return addr + strconv.Itoa((*ports)[1])
+	suffix := secret
+	if suffix == "" {
+		// instance shared by all the ARAs of the node
+		suffix = SharedIPFSSuffix
+	}
+	path := s.MyIPFSPath + "-" + suffix
+	if err := CreateEmptyDir(path); err != nil {
+		return nil, err
+	}
 
-}
+	s.startMeasure(path, ipfsStartupMeasure)
+	defer s.recordMeasure(path)
 
-// EditIPFSField with the native IPFS config command
-func EditIPFSField(path, field, value string) {
-	cmd := "ipfs -c " + path + " config --json " + field + " " + value
-	o, err := exec.Command("bash", "-c", cmd).Output()
+	ports, err := s.reservePorts(IPFSPortNumber)
 	if err != nil {
-		fmt.Println(cmd)
-		fmt.Println(string(o))
-		fmt.Println(err)
+		return nil, err
 	}
-}
-
-// SetClusterLeaderConfig set the configs for the leader of a cluster
-func (s *Service) SetClusterLeaderConfig(path, apiIPFSAddr string,
-	replmin, replmax int, ports ClusterInstance) (
-	string, string, error) {
-
-	// generate random secret
-	key := make([]byte, 32)
-	_, err := rand.Read(key)
+	profile, err := s.newIPFSProfile(ports)
 	if err != nil {
-		return "", "", errors.New("could not generate secret")
+		s.releasePorts(ports...)
+		return nil, err
+	}
+	i := &Instance{
+		Kind:        IPFSKind,
+		Node:        s.Name,
+		Secret:      secret,
+		Path:        path,
+		Ports:       ports,
+		IPFSProfile: profile,
+	}
+	if s.IPFSRouting != "" {
+		i.IPFSProfile.RoutingType = s.IPFSRouting
+	}
+	if s.PrivateIPFS && secret != "" {
+		i.IPFSProfile.SwarmKey = SwarmKey(secret)
+		// only the ARA members can be bootstrap peers
+		i.IPFSProfile.Bootstrap = []string{}
+		for _, b := range bootstrap {
+			if b != "" {
+				i.IPFSProfile.Bootstrap = append(i.IPFSProfile.Bootstrap, b)
+			}
+		}
 	}
-	secret := hex.EncodeToString(key)
-
-	vars := GetClusterVariables(path, s.MyIP, s.Name, secret, apiIPFSAddr,
-		replmin, replmax, ports)
-	return vars, secret, nil
-}
-
-// GetClusterVariables get the cluster variables
-func GetClusterVariables(path, ip, secret, peername, apiIPFSAddr string,
-	replmin, replmax int, ports ClusterInstance) string {
-
-	//apiIPFSAddr := IPVersion + ip +
-	//	TransportProtocol + strconv.Itoa(ports.IPFSAPIPort) // 5001
-	restAPIAddr := IPVersion + ip +
-		TransportProtocol + strconv.Itoa(ports.RestAPIPort) // 9094
-	IPFSProxyAddr := IPVersion + ip +
-		TransportProtocol + strconv.Itoa(ports.IPFSProxyPort) // 9095
-	clusterAddr := IPVersion + ip +
-		TransportProtocol + strconv.Itoa(ports.ClusterPort) // 9096
-
-	cmd := ""
-
-	// edit peername
-	cmd += GetEnvVar("CLUSTER_PEERNAME", peername)
-
-	// edit the secret
-	cmd += GetEnvVar("CLUSTER_SECRET", secret)
-
-	cmd += GetEnvVar("CLUSTER_REPLICATIONFACTORMIN", "3")
-	cmd += GetEnvVar("CLUSTER_REPLICATIONFACTORMAX", "3")
-
-	// replace IPFS API port (5001)
-	cmd += GetEnvVar("CLUSTER_IPFSPROXY_NODEMULTIADDRESS", apiIPFSAddr) // 5001
-	cmd += GetEnvVar("CLUSTER_IPFSHTTP_NODEMULTIADDRESS", apiIPFSAddr)  // 5001
-
-	// replace Cluster ports (9094, 9095, 9096)
-	cmd += GetEnvVar("CLUSTER_RESTAPI_HTTPLISTENMULTIADDRESS", restAPIAddr) // 9094
-	cmd += GetEnvVar("CLUSTER_IPFSPROXY_LISTENMULTIADDRESS", IPFSProxyAddr) // 9095
-	cmd += GetEnvVar("CLUSTER_LISTENMULTIADDRESS", clusterAddr)             // 9096
-
-	// replace replication factor
-	cmd += GetEnvVar("CLUSTER_REPLICATIONFACTORMIN", strconv.Itoa(replmin))
-	cmd += GetEnvVar("CLUSTER_REPLICATIONFACTORMAX", strconv.Itoa(replmax))
-
-	return cmd
-}
-
-// GetEnvVar get the environnment variable for the given field and value
-func GetEnvVar(field, value string) string {
-	// `CLUSTER_FIELD="value" `
-	return field + "=\"" + value + "\" "
-}
-
-// MakeJSONElem make a JSON single element
-func MakeJSONElem(elem string) string {
-	// \"elem\"
-	return "\\\"" + elem + "\\\""
-}
 
-// MakeJSONArray make a json array from the given elements
-func MakeJSONArray(elements []string) string {
-	// "[
-	str := "\"["
-	for _, e := range elements {
-		// \"elem\"
-		str += "\\\"" + e + "\\\""
+	// init the repo, start the ipfs daemon and wait until it has started
+	if err := s.launch(i, IPFSStartupTime); err != nil {
+		return nil, err
 	}
-	// str + ]"
-	return str + "]\""
+	return i, nil
 }
 
-// SetupClusterLeader setup a cluster instance for the ARA leader
-func (s *Service) SetupClusterLeader(path, secret, apiIPFSAddr string,
-	replmin, replmax int) (string, *ClusterInstance, error) {
-
-	//path = path //+ "-" + secret
-	if err := CreateEmptyDir(path); err != nil {
-		return "", nil, err
+// newIPFSProfile returns the profile of a new IPFS instance using the given
+// reserved ports
+func (s *Service) newIPFSProfile(ports []int) (*IPFSProfile, error) {
+	api, err := s.Addrs.TCPAddr(s.MyIP, ports[1]) // /ip4/127.0.0.1/tcp/5001
+	if err != nil {
+		return nil, err
 	}
-
-	s.PortMutex.Lock()
-	ints, err := GetNextAvailablePorts(s.MinPort, s.MaxPort, ClusterPortNumber)
+	gateway, err := s.Addrs.TCPAddr(s.MyIP, ports[2]) // /ip4/127.0.0.1/tcp/8080
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
-
-	// set the ports that the cluster will use
-	ports := ClusterInstance{
-		HostName:      s.Name,
-		IP:            IPVersion + s.MyIP + TransportProtocol,
-		IPFSAPIAddr:   apiIPFSAddr,
-		RestAPIPort:   (*ints)[0],
-		IPFSProxyPort: (*ints)[1],
-		ClusterPort:   (*ints)[2],
+	swarm, err := s.Addrs.SwarmAddr(s.MyIP, ports[0]) // /ip4/0.0.0.0/tcp/4001
+	if err != nil {
+		return nil, err
 	}
+	profile := DefaultIPFSProfile(api, gateway, swarm)
+
+	// filling my IPFS info
+	s.InstancesMutex.Lock()
+	s.MyIPFS = append(s.MyIPFS, IPFSInformation{
+		Name:        s.Name,
+		IP:          s.MyIP,
+		SwarmPort:   ports[0],
+		APIPort:     ports[1],
+		GatewayPort: ports[2],
+	})
+	s.InstancesMutex.Unlock()
+	return profile, nil
+}
 
-	// get the environment variables to set cluster configs
-	vars := GetClusterVariables(path, s.MyIP, secret, s.Name, apiIPFSAddr,
-		replmin, replmax, ports)
+// SetupClusterLeader setup a cluster instance for the ARA leader
+func (s *Service) SetupClusterLeader(path, secret, apiIPFSAddr string,
+	profile *ClusterProfile) (string, *ClusterInstance, error) {
 
-	// init command to be run
-	cmd := vars + "ipfs-cluster-service -c " + path + " init"
-	if ClusterConsensusMode == "crdt" {
-		cmd += " --consensus crdt"
-	}
-	o, err := exec.Command("bash", "-c", cmd).Output()
+	ports, err := s.startCluster(path, "", secret, apiIPFSAddr, profile)
 	if err != nil {
-		fmt.Println(cmd)
-		fmt.Println(string(o))
-		fmt.Println(err)
 		return "", nil, err
 	}
-
-	// start cluster daemon
-	cmd = "ipfs-cluster-service -c " + path + " daemon"
-	go func() {
-		exec.Command("bash", "-c", cmd).Run()
-		log.Lvl1(s.Name + " cluster leader crashed")
-	}()
-
-	// wait for the daemon to be launched
-	time.Sleep(ClusterStartupTime)
-	s.PortMutex.Unlock()
-
-	addr := IPVersion + s.MyIP + TransportProtocol + strconv.Itoa(ports.RestAPIPort)
-	log.Lvl2("Started ipfs-cluster leader at " + addr)
-
-	return secret, &ports, nil
+	log.Lvl2("Started ipfs-cluster leader at " + clusterAPIAddr(ports))
+	return secret, ports, nil
 }
 
 // SetupClusterSlave setup a cluster slave instance
 func (s *Service) SetupClusterSlave(path, bootstrap, secret, apiIPFSAddr string,
-	replmin, replmax int) (*ClusterInstance, error) {
+	profile *ClusterProfile) (*ClusterInstance, error) {
 
-	err := CreateEmptyDir(path)
+	ports, err := s.startCluster(path, bootstrap, secret, apiIPFSAddr, profile)
 	if err != nil {
+		log.Lvl1(err)
+		return nil, err
+	}
+	log.Lvl2("Started ipfs-cluster slave at " + clusterAPIAddr(ports))
+	return ports, nil
+}
+
+// startCluster starts a cluster instance, bootstrapping to the given address
+// if not empty
+func (s *Service) startCluster(path, bootstrap, secret, apiIPFSAddr string,
+	profile *ClusterProfile) (*ClusterInstance, error) {
+
+	if err := CreateEmptyDir(path); err != nil {
 		return nil, err
 	}
 
-	s.PortMutex.Lock()
+	s.startMeasure(path, clusterStartupMeasure)
+	defer s.recordMeasure(path)
 
-	ints, err := GetNextAvailablePorts(s.MinPort, s.MaxPort, ClusterPortNumber)
+	ints, err := s.reservePorts(ClusterPortNumber)
 	if err != nil {
-		log.Lvl1(err)
 		return nil, err
 	}
 
 	// set the ports that the cluster will use
 	ports := ClusterInstance{
 		HostName:      s.Name,
-		IP:            IPVersion + s.MyIP + TransportProtocol,
+		IP:            s.MyIP,
 		IPFSAPIAddr:   apiIPFSAddr,
-		RestAPIPort:   (*ints)[0],
-		IPFSProxyPort: (*ints)[1],
-		ClusterPort:   (*ints)[2],
+		RestAPIPort:   ints[0],
+		IPFSProxyPort: ints[1],
+		ClusterPort:   ints[2],
 	}
-
-	// get the environment variables to set cluster configs
-	vars := GetClusterVariables(path, s.MyIP, secret, s.Name, apiIPFSAddr,
-		replmin, replmax, ports)
-
-	// init command to be run
-	cmd := vars + "ipfs-cluster-service -c " + path + " init"
-	if ClusterConsensusMode == "crdt" {
-		cmd += " --consensus crdt"
+	ports.RestAPIAddr, err = s.Addrs.TCPAddr(s.MyIP, ports.RestAPIPort)
+	if err == nil {
+		ports.IPFSProxyAddr, err = s.Addrs.TCPAddr(s.MyIP, ports.IPFSProxyPort)
+	}
+	if err == nil {
+		ports.ClusterAddr, err = s.Addrs.TCPAddr(s.MyIP, ports.ClusterPort)
 	}
-	err = exec.Command("bash", "-c", cmd).Run()
 	if err != nil {
-		log.Lvl1(err)
+		s.releasePorts(ints...)
 		return nil, err
 	}
 
-	// start cluster daemon
-	cmd = "ipfs-cluster-service -c " + path + " daemon --bootstrap " + bootstrap
-	go func() {
-		o, err := exec.Command("bash", "-c", cmd).Output()
-		log.Lvl1("slave " + s.Name + " crashed")
-		log.Lvl1(string(o))
-		log.Lvl1(err)
-		log.Lvl1(cmd)
-	}()
-
-	// wait for the daemon to be launched
-	time.Sleep(ClusterStartupTime)
-	s.PortMutex.Unlock()
-
-	addr := ports.IP + strconv.Itoa(ports.RestAPIPort)
-	//log.Lvl1("ipfs-cluster-service -c " + path + " daemon --bootstrap " + bootstrap)
-	log.Lvl2("Started ipfs-cluster slave at " + addr)
+	i := &Instance{
+		Kind:        ClusterKind,
+		Node:        s.Name,
+		Secret:      secret,
+		Path:        path,
+		Ports:       ints,
+		Cluster:     &ports,
+		Profile:     profile,
+		IPFSAPIAddr: apiIPFSAddr,
+		Bootstrap:   bootstrap,
+	}
 
+	// generate the cluster configs, start the cluster daemon and wait for it
+	// to be launched
+	if err := s.launch(i, ClusterStartupTime); err != nil {
+		return nil, err
+	}
+	ports.PeerID = i.PeerID
 	return &ports, nil
 }
 
 // StartIPFSAndCluster starts an IPFS instance along with the cluster instance
 // empty secret means that this instance is the cluster leader
-// if leader, returns secret and the started instance information containing
-// bootstrap address for slaves
-func (s *Service) StartIPFSAndCluster(leader, secret,
-	bootstrap string) *ClusterInstance {
-
+// the cluster instance bootstraps to the first reachable address of the
+// ordered list of candidates, an empty list means that this instance is the
+// cluster leader
+func (s *Service) StartIPFSAndCluster(leader, secret string, bootstraps,
+	ipfsBootstrap []string, profile *ClusterProfile) (*ClusterInstance, error) {
+
+	if s.setupErr != nil {
+		return nil, s.setupErr
+	}
 	clusterPath := filepath.Join(s.ConfigPath, leader+"-"+secret)
 
 	// if no secret -> this instance is the leader
@@ -333,20 +246,48 @@ func (s *Service) StartIPFSAndCluster(leader, secret,
 	}
 
 	// start ipfs and get the multiaddr of the IPFS API
-	apiIPFSAddr := s.StartIPFS(secret)
-
+	var ipfs *Instance
 	var err error
+	if s.SharedIPFS {
+		ipfs, err = s.startSharedIPFS()
+	} else {
+		ipfs, err = s.startIPFS(secret, ipfsBootstrap)
+	}
+	if err != nil {
+		return nil, err
+	}
+	apiIPFSAddr := s.Backend.APIAddr(ipfs)
+
 	var instance *ClusterInstance
-	if bootstrap == "" {
+	if len(bootstraps) == 0 {
 		// leader
 		_, instance, err = s.SetupClusterLeader(clusterPath, secret, apiIPFSAddr,
-			DefaultReplMin, DefaultReplMax)
+			profile)
 	} else {
 		// slave
-		instance, err = s.SetupClusterSlave(clusterPath, bootstrap, secret, apiIPFSAddr,
-			DefaultReplMin, DefaultReplMax)
+		instance, err = s.SetupClusterSlave(clusterPath,
+			selectBootstrap(bootstraps), secret, apiIPFSAddr, profile)
+	}
+	if err != nil {
+		return nil, err
 	}
-	checkErr(err)
+	instance.IPFSSwarmAddr = ipfsSwarmAddr(ipfs)
+	instance.GatewayAddr = ipfs.IPFSProfile.GatewayAddr
 
-	return instance
+	return instance, nil
+}
+
+// startSharedIPFS starts the IPFS instance shared by all the ARAs of the node
+// if it is not running yet
+func (s *Service) startSharedIPFS() (*Instance, error) {
+	s.sharedIPFSMutex.Lock()
+	defer s.sharedIPFSMutex.Unlock()
+	if s.sharedIPFS == nil {
+		i, err := s.startIPFS("", nil)
+		if err != nil {
+			return nil, err
+		}
+		s.sharedIPFS = i
+	}
+	return s.sharedIPFS, nil
 }
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// IPFSConfigFile name of the configuration file in an IPFS repo
+	IPFSConfigFile = "config"
+	// IPFSSwarmKeyFile name of the private network key file in an IPFS repo
+	IPFSSwarmKeyFile = "swarm.key"
+)
+
+// IPFSProfile typed description of the fields that the service sets in the
+// configuration of an IPFS repo
+type IPFSProfile struct {
+	APIAddr     string
+	GatewayAddr string
+	SwarmAddrs  []string
+	// Bootstrap list of bootstrap peers, nil keeps the default public
+	// bootstrap peers and an empty list removes them
+	Bootstrap []string
+	// RoutingType "dht", "dhtclient" or "none"
+	RoutingType string
+	// SwarmKey content of the swarm.key file, if not empty the instance only
+	// connects to peers having the same key
+	SwarmKey string
+
+	// connection manager limits
+	ConnMgrLowWater    int
+	ConnMgrHighWater   int
+	ConnMgrGracePeriod string
+
+	// resource limits, ignored if ResourceMgrEnabled is false
+	ResourceMgrEnabled bool
+	MaxMemory          string
+	MaxFileDescriptors int
+}
+
+// DefaultIPFSProfile returns the profile used for instances started by the
+// service, with the given API, gateway and swarm multiaddresses
+func DefaultIPFSProfile(api, gateway string, swarm ...string) *IPFSProfile {
+	return &IPFSProfile{
+		APIAddr:            api,
+		GatewayAddr:        gateway,
+		SwarmAddrs:         swarm,
+		RoutingType:        DefaultIPFSRouting,
+		ConnMgrLowWater:    DefaultConnMgrLowWater,
+		ConnMgrHighWater:   DefaultConnMgrHighWater,
+		ConnMgrGracePeriod: DefaultConnMgrGracePeriod,
+	}
+}
+
+// ReadIPFSConfig reads the configuration of the IPFS repo at the given path.
+// The configuration is kept as a generic JSON object so that the fields that
+// the service doesn't know about are written back untouched.
+func ReadIPFSConfig(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, IPFSConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	cfg := make(map[string]interface{})
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// WriteIPFSConfig writes the configuration of the IPFS repo at the given path
+func WriteIPFSConfig(path string, cfg map[string]interface{}) error {
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(path, IPFSConfigFile), b,
+		defaultFileMode)
+}
+
+// ApplyIPFSProfile sets the fields of the given profile in the configuration
+// of the IPFS repo at the given path
+func ApplyIPFSProfile(path string, p *IPFSProfile) error {
+	cfg, err := ReadIPFSConfig(path)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{
+		"Addresses.API":     p.APIAddr,
+		"Addresses.Gateway": p.GatewayAddr,
+		"Addresses.Swarm":   p.SwarmAddrs,
+	}
+	if p.Bootstrap != nil {
+		fields["Bootstrap"] = p.Bootstrap
+	}
+	if p.RoutingType != "" {
+		fields["Routing.Type"] = p.RoutingType
+	}
+	for _, a := range p.SwarmAddrs {
+		if strings.Contains(a, "/quic") {
+			fields["Experimental.QUIC"] = true
+		}
+	}
+	if p.ConnMgrHighWater > 0 {
+		fields["Swarm.ConnMgr.Type"] = "basic"
+		fields["Swarm.ConnMgr.LowWater"] = p.ConnMgrLowWater
+		fields["Swarm.ConnMgr.HighWater"] = p.ConnMgrHighWater
+		fields["Swarm.ConnMgr.GracePeriod"] = p.ConnMgrGracePeriod
+	}
+	if p.ResourceMgrEnabled {
+		fields["Swarm.ResourceMgr.Enabled"] = true
+		if p.MaxMemory != "" {
+			fields["Swarm.ResourceMgr.MaxMemory"] = p.MaxMemory
+		}
+		if p.MaxFileDescriptors > 0 {
+			fields["Swarm.ResourceMgr.MaxFileDescriptors"] =
+				p.MaxFileDescriptors
+		}
+	}
+
+	for field, value := range fields {
+		if err := setConfigField(cfg, field, value); err != nil {
+			return err
+		}
+	}
+	if p.SwarmKey != "" {
+		err = ioutil.WriteFile(filepath.Join(path, IPFSSwarmKeyFile),
+			[]byte(p.SwarmKey), defaultFileMode)
+		if err != nil {
+			return err
+		}
+	}
+	return WriteIPFSConfig(path, cfg)
+}
+
+// SwarmKey derives the private network key of an ARA from its cluster
+// secret, so that only the members of the ARA can connect to each other
+func SwarmKey(secret string) string {
+	key := sha256.Sum256([]byte("swarm key:" + secret))
+	return "/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(key[:])
+}
+
+// IPFSPeerID reads the peer id of the IPFS repo at the given path
+func IPFSPeerID(path string) (string, error) {
+	cfg, err := ReadIPFSConfig(path)
+	if err != nil {
+		return "", err
+	}
+	identity, ok := cfg["Identity"].(map[string]interface{})
+	if !ok {
+		return "", errors.New("no identity in ipfs config at " + path)
+	}
+	id, ok := identity["PeerID"].(string)
+	if !ok || id == "" {
+		return "", errors.New("no peer id in ipfs config at " + path)
+	}
+	return id, nil
+}
+
+// setConfigField sets the value of a dotted field (e.g. "Addresses.API") in
+// a generic JSON object, creating the intermediate objects if needed
+func setConfigField(cfg map[string]interface{}, field string,
+	value interface{}) error {
+
+	keys := strings.Split(field, ".")
+	m := cfg
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k]
+		if !ok || next == nil {
+			next = make(map[string]interface{})
+			m[k] = next
+		}
+		sub, ok := next.(map[string]interface{})
+		if !ok {
+			return errors.New("config field " + k + " of " + field +
+				" is not an object")
+		}
+		m = sub
+	}
+	m[keys[len(keys)-1]] = value
+	return nil
+}
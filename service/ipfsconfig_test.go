@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestSetConfigField(t *testing.T) {
+	cfg := map[string]interface{}{
+		"Addresses": map[string]interface{}{"API": "old", "Gateway": "gw"},
+		"Bootstrap": []interface{}{"peer"},
+	}
+
+	// existing object
+	if err := setConfigField(cfg, "Addresses.API", "api"); err != nil {
+		t.Fatal(err)
+	}
+	addrs := cfg["Addresses"].(map[string]interface{})
+	if addrs["API"] != "api" || addrs["Gateway"] != "gw" {
+		t.Fatal("wrong addresses:", addrs)
+	}
+
+	// missing intermediate objects
+	if err := setConfigField(cfg, "Swarm.ConnMgr.HighWater", 10); err != nil {
+		t.Fatal(err)
+	}
+	connMgr := cfg["Swarm"].(map[string]interface{})["ConnMgr"]
+	if connMgr.(map[string]interface{})["HighWater"] != 10 {
+		t.Fatal("wrong connection manager:", connMgr)
+	}
+
+	// top level field
+	if err := setConfigField(cfg, "Bootstrap", []string{}); err != nil {
+		t.Fatal(err)
+	}
+	if b := cfg["Bootstrap"].([]string); len(b) != 0 {
+		t.Fatal("bootstrap list not replaced:", b)
+	}
+
+	// a field that is not an object cannot be traversed
+	if err := setConfigField(cfg, "Bootstrap.Peer", "p"); err == nil {
+		t.Fatal("no error setting a field of a list")
+	}
+}
+
+func TestDefaultIPFSProfileBootstrap(t *testing.T) {
+	p := DefaultIPFSProfile("/ip4/127.0.0.1/tcp/5001",
+		"/ip4/127.0.0.1/tcp/8080", "/ip4/127.0.0.1/tcp/4001")
+	if p.Bootstrap != nil {
+		t.Fatal("the default profile overrides the bootstrap list:",
+			p.Bootstrap)
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"sync/atomic"
+
+	"go.dedis.ch/onet/v3/simul/monitor"
+)
+
+// names of the time measures reported to the onet monitor
+const (
+	pingsMeasure          = "pings"
+	araGenerationMeasure  = "ara_generation"
+	ipfsStartupMeasure    = "ipfs_startup"
+	clusterStartupMeasure = "cluster_startup"
+	roundMeasurePrefix    = "round_"
+)
+
+// SetCounter sets the onet counter (typically the onet.Server of the node)
+// from which the bandwidth and message counters are read
+func (s *Service) SetCounter(c monitor.CounterIO) {
+	s.counter = c
+}
+
+// startMeasure starts a time measure with the given name, the key identifies
+// the measure until it is recorded
+func (s *Service) startMeasure(key, name string) {
+	s.metricsMutex.Lock()
+	defer s.metricsMutex.Unlock()
+	if s.metrics == nil {
+		s.metrics = make(map[string]*monitor.TimeMeasure)
+	}
+	s.metrics[key] = monitor.NewTimeMeasure(name)
+}
+
+// recordMeasure records the time measure with the given key to the monitor
+func (s *Service) recordMeasure(key string) {
+	s.metricsMutex.Lock()
+	m, ok := s.metrics[key]
+	delete(s.metrics, key)
+	s.metricsMutex.Unlock()
+	if ok {
+		m.Record()
+	}
+}
+
+// countProtocol increments the number of protocol instances of the node
+func (s *Service) countProtocol() {
+	atomic.AddUint64(&s.NrProtocolsStarted, 1)
+}
+
+// updateCounters reads the bandwidth and message counters from onet
+func (s *Service) updateCounters() {
+	if s.counter == nil {
+		return
+	}
+	atomic.StoreUint64(&s.BandwidthRx, s.counter.Rx())
+	atomic.StoreUint64(&s.BandwidthTx, s.counter.Tx())
+	atomic.StoreUint64(&s.NrMsgRx, s.counter.MsgRx())
+	atomic.StoreUint64(&s.NrMsgTx, s.counter.MsgTx())
+}
+
+// ReportCounters records the bandwidth, message and protocol counters of the
+// node to the monitor
+func (s *Service) ReportCounters() {
+	s.updateCounters()
+	monitor.RecordSingleMeasure("bandwidth_rx",
+		float64(atomic.LoadUint64(&s.BandwidthRx)))
+	monitor.RecordSingleMeasure("bandwidth_tx",
+		float64(atomic.LoadUint64(&s.BandwidthTx)))
+	monitor.RecordSingleMeasure("msg_rx",
+		float64(atomic.LoadUint64(&s.NrMsgRx)))
+	monitor.RecordSingleMeasure("msg_tx",
+		float64(atomic.LoadUint64(&s.NrMsgTx)))
+	monitor.RecordSingleMeasure("protocols_started",
+		float64(atomic.LoadUint64(&s.NrProtocolsStarted)))
+}
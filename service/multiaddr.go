@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"strconv"
+
+	ma "github.com/multiformats/go-multiaddr"
+	// registers the dns4 and dns6 protocols
+	_ "github.com/multiformats/go-multiaddr-dns"
+)
+
+// AddrConfig families and transports of the addresses of the instances
+type AddrConfig struct {
+	// Family "ip4", "ip6", "dns4" or "dns6", empty to derive it from the host
+	Family string
+	// SwarmTransport "tcp" or "quic", transport of the ipfs swarm. The
+	// cluster, API, gateway and proxy listeners are always tcp.
+	SwarmTransport string
+}
+
+// DefaultAddrConfig returns the address configuration used when nothing else
+// is specified in the InitRequest
+func DefaultAddrConfig() AddrConfig {
+	return AddrConfig{SwarmTransport: DefaultSwarmTransport}
+}
+
+// hostFamily returns the multiaddr protocol of the given host
+func (c AddrConfig) hostFamily(host string) string {
+	if c.Family != "" {
+		return c.Family
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "dns4"
+	case ip.To4() != nil:
+		return "ip4"
+	default:
+		return "ip6"
+	}
+}
+
+// HostAddr returns the multiaddress of the given host, e.g. /ip4/10.0.0.1
+func (c AddrConfig) HostAddr(host string) (ma.Multiaddr, error) {
+	return ma.NewMultiaddr("/" + c.hostFamily(host) + "/" + host)
+}
+
+// TCPAddr returns the multiaddress of a tcp listener of the given host
+func (c AddrConfig) TCPAddr(host string, port int) (string, error) {
+	h, err := c.HostAddr(host)
+	if err != nil {
+		return "", err
+	}
+	t, err := ma.NewMultiaddr("/tcp/" + strconv.Itoa(port))
+	if err != nil {
+		return "", err
+	}
+	return h.Encapsulate(t).String(), nil
+}
+
+// SwarmAddr returns the multiaddress of a libp2p listener of the given host,
+// using the swarm transport
+func (c AddrConfig) SwarmAddr(host string, port int) (string, error) {
+	switch c.SwarmTransport {
+	case "", "tcp":
+		return c.TCPAddr(host, port)
+	case "quic":
+		h, err := c.HostAddr(host)
+		if err != nil {
+			return "", err
+		}
+		t, err := ma.NewMultiaddr("/udp/" + strconv.Itoa(port) + "/quic")
+		if err != nil {
+			return "", err
+		}
+		return h.Encapsulate(t).String(), nil
+	}
+	return "", errors.New("unknown swarm transport " + c.SwarmTransport)
+}
+
+// bindIP returns the first of the given IPs that belongs to the subnet,
+// followed by the addresses of the local interfaces
+func bindIP(subnet string, ips []string) (string, error) {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", err
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok {
+				ips = append(ips, n.IP.String())
+			}
+		}
+	}
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil && network.Contains(parsed) {
+			return ip, nil
+		}
+	}
+	return "", errors.New("no address in subnet " + subnet)
+}
+
+// HTTPAddr converts a tcp multiaddress (/ip4, /ip6, /dns4 or /dns6) to a
+// host:port address
+func HTTPAddr(addr string) (string, error) {
+	m, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return "", err
+	}
+	port, err := m.ValueForProtocol(ma.P_TCP)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"ip4", "ip6", "dns4", "dns6", "dns"} {
+		p := ma.ProtocolWithName(name)
+		if p.Code == 0 {
+			continue
+		}
+		if host, err := m.ValueForProtocol(p.Code); err == nil {
+			return net.JoinHostPort(host, port), nil
+		}
+	}
+	return "", errors.New("no host in multiaddress " + addr)
+}
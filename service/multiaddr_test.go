@@ -0,0 +1,58 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestHTTPAddr(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"/ip4/10.0.0.1/tcp/9094":          "10.0.0.1:9094",
+		"/ip6/::1/tcp/5001":               "[::1]:5001",
+		"/dns4/node.example.org/tcp/8080": "node.example.org:8080",
+		"/ip4/10.0.0.1/tcp/9096/ipfs/" +
+			"QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N": "10.0.0.1:9096",
+	} {
+		host, err := HTTPAddr(addr)
+		if err != nil {
+			t.Fatal(addr, err)
+		}
+		if host != expected {
+			t.Fatal(addr, "gives", host, "instead of", expected)
+		}
+	}
+
+	for _, addr := range []string{
+		"",
+		"10.0.0.1:9094",
+		"/ip4/10.0.0.1/udp/4001/quic",
+	} {
+		if _, err := HTTPAddr(addr); err == nil {
+			t.Fatal("no error for", addr)
+		}
+	}
+}
+
+func TestSwarmAddr(t *testing.T) {
+	c := AddrConfig{SwarmTransport: "quic"}
+	addr, err := c.SwarmAddr("10.0.0.1", 4001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "/ip4/10.0.0.1/udp/4001/quic" {
+		t.Fatal("wrong quic address", addr)
+	}
+
+	// the other listeners always use tcp
+	addr, err = c.TCPAddr("10.0.0.1", 9096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "/ip4/10.0.0.1/tcp/9096" {
+		t.Fatal("wrong tcp address", addr)
+	}
+
+	c.SwarmTransport = "ws"
+	if _, err := c.SwarmAddr("10.0.0.1", 4001); err == nil {
+		t.Fatal("no error for an unknown transport")
+	}
+}
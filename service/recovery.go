@@ -0,0 +1,113 @@
+package service
+
+import (
+	"go.dedis.ch/onet/v3/log"
+)
+
+// Adopter is implemented by the backends able to take control of an instance
+// that is already running, e.g. started before the conode restarted
+type Adopter interface {
+	// Adopt takes control of the running instance
+	Adopt(i *Instance) error
+}
+
+// saveState persists the instances and the ARAs of the node through the onet
+// storage
+func (s *Service) saveState() {
+	s.InstancesMutex.Lock()
+	instances := make([]Instance, len(s.Instances))
+	for n, i := range s.Instances {
+		instances[n] = *i
+	}
+	myIPFS := append([]IPFSInformation{}, s.MyIPFS...)
+	aras := append([]ClusterInfo{}, s.ARAs...)
+	s.InstancesMutex.Unlock()
+
+	s.storage.Lock()
+	s.storage.Name = s.Name
+	s.storage.ConfigPath = s.ConfigPath
+	s.storage.MinPort = s.MinPort
+	s.storage.MaxPort = s.MaxPort
+	s.storage.MyIPFS = myIPFS
+	s.storage.ARAs = aras
+	s.storage.Instances = instances
+	s.storage.SharedIPFS = s.SharedIPFS
+	s.storage.Unlock()
+	s.save()
+}
+
+// recoverInstances re-adopts the instances saved in the storage that are
+// still running, and relaunches the others from their existing repos
+func (s *Service) recoverInstances() {
+	s.storage.Lock()
+	saved := append([]Instance{}, s.storage.Instances...)
+	s.Name = s.storage.Name
+	s.ConfigPath = s.storage.ConfigPath
+	s.MinPort = s.storage.MinPort
+	s.MaxPort = s.storage.MaxPort
+	s.MyIPFS = append([]IPFSInformation{}, s.storage.MyIPFS...)
+	s.ARAs = append([]ClusterInfo{}, s.storage.ARAs...)
+	s.SharedIPFS = s.storage.SharedIPFS
+	s.storage.Unlock()
+
+	if len(saved) == 0 {
+		return
+	}
+	log.Lvl1(s.Name, "recovering", len(saved), "instances")
+	s.recovered = true
+
+	// ipfs instances first, cluster instances need their ipfs daemon
+	for _, kind := range []InstanceKind{IPFSKind, ClusterKind} {
+		for n := range saved {
+			i := &saved[n]
+			if i.Kind != kind {
+				continue
+			}
+			// the ports of the instance stay reserved
+			s.PortMutex.Lock()
+			if s.reservedPorts == nil {
+				s.reservedPorts = make(map[int]bool)
+			}
+			for _, p := range i.Ports {
+				s.reservedPorts[p] = true
+			}
+			s.PortMutex.Unlock()
+			if err := s.recoverInstance(i); err != nil {
+				log.Error(s.Name, "failed to recover", i.Kind, "instance at",
+					i.Path+":", err)
+				s.releasePorts(i.Ports...)
+				continue
+			}
+			s.addInstance(i)
+			if i.Kind == IPFSKind && i.Secret == "" && s.SharedIPFS {
+				s.sharedIPFS = i
+			}
+		}
+	}
+	s.saveState()
+}
+
+// recoverInstance re-adopts a running instance or relaunches it
+func (s *Service) recoverInstance(i *Instance) error {
+	timeout := IPFSStartupTime
+	if i.Kind == ClusterKind {
+		timeout = ClusterStartupTime
+		// a restarted peer already knows the peers of its ARA
+		if i.Profile != nil && i.Profile.Consensus == "raft" {
+			i.Bootstrap = ""
+		}
+	}
+
+	if s.Backend.Ready(i) {
+		if a, ok := s.Backend.(Adopter); ok {
+			log.Lvl2(s.Name, "adopting", i.Kind, "instance at", i.Path)
+			return a.Adopt(i)
+		}
+	}
+
+	log.Lvl2(s.Name, "relaunching", i.Kind, "instance at", i.Path)
+	if err := s.Backend.Start(i); err != nil {
+		return err
+	}
+	return s.waitReady(i, timeout)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// setStartConcurrency sets the max number of instances of the node that are
+// started at the same time, 0 or less means no limit
+func (s *Service) setStartConcurrency(n int) {
+	if n <= 0 {
+		s.startSlots = nil
+		return
+	}
+	s.startSlots = make(chan struct{}, n)
+}
+
+// launch initializes and starts an instance and waits until it is ready,
+// holding one of the start slots of the node. The instance is stopped and its
+// ports released if it is not ready after the timeout.
+func (s *Service) launch(i *Instance, timeout time.Duration) error {
+	if s.startSlots != nil {
+		s.startSlots <- struct{}{}
+		defer func() { <-s.startSlots }()
+	}
+
+	s.updateProgress(i.Secret, func(p *ARAProgress) { p.Started++ })
+	err := s.launchInstance(i, timeout)
+	s.updateProgress(i.Secret, func(p *ARAProgress) {
+		p.Started--
+		if err != nil {
+			p.Failed++
+		} else {
+			p.Ready++
+		}
+	})
+	if err != nil {
+		s.releasePorts(i.Ports...)
+	}
+	return err
+}
+
+// launchInstance initializes, starts and waits for an instance
+func (s *Service) launchInstance(i *Instance, timeout time.Duration) error {
+	// init the repo and generate the config
+	if err := s.Backend.Init(i); err != nil {
+		return err
+	}
+
+	// start the daemon
+	if err := s.Backend.Start(i); err != nil {
+		return err
+	}
+	s.addInstance(i)
+
+	// wait until it has started, an instance that is not ready cannot be used
+	// as a bootstrap
+	if err := s.waitReady(i, timeout); err != nil {
+		s.removeInstance(i)
+		if stopErr := s.Backend.Stop(i); stopErr != nil {
+			log.Lvl2(stopErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// reservePorts reserves n available ports of the node port range. The ports
+// stay reserved until they are released, so that instances that are not
+// listening yet don't get the same ports.
+func (s *Service) reservePorts(n int) ([]int, error) {
+	s.PortMutex.Lock()
+	defer s.PortMutex.Unlock()
+	if s.reservedPorts == nil {
+		s.reservedPorts = make(map[int]bool)
+	}
+
+	used, err := GetUsedPorts()
+	if err != nil {
+		return nil, err
+	}
+	ports, err := freePorts(s.MinPort, s.MaxPort, n, used, s.reservedPorts)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ports {
+		s.reservedPorts[p] = true
+	}
+	return ports, nil
+}
+
+// freePorts returns the first n ports between pmin and pmax that are neither
+// used nor reserved
+func freePorts(pmin, pmax, n int, used, reserved map[int]bool) ([]int, error) {
+	ports := make([]int, 0, n)
+	for p := pmin; p <= pmax && len(ports) < n; p++ {
+		if !used[p] && !reserved[p] {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) != n {
+		return nil, errors.New("no " + strconv.Itoa(n) + " available ports")
+	}
+	return ports, nil
+}
+
+// releasePorts releases reserved ports
+func (s *Service) releasePorts(ports ...int) {
+	s.PortMutex.Lock()
+	defer s.PortMutex.Unlock()
+	for _, p := range ports {
+		delete(s.reservedPorts, p)
+	}
+}
+
+// updateProgress applies the given update to the startup progress of the ARA
+// with the given secret
+func (s *Service) updateProgress(secret string, update func(p *ARAProgress)) {
+	s.progressMutex.Lock()
+	defer s.progressMutex.Unlock()
+	if s.progress == nil {
+		s.progress = make(map[string]*ARAProgress)
+	}
+	p, ok := s.progress[secret]
+	if !ok {
+		p = &ARAProgress{Secret: secret}
+		s.progress[secret] = p
+	}
+	update(p)
+	log.Lvl3(s.Name, "ARA", secret, "progress:", p.Started, "started,",
+		p.Ready, "ready,", p.Failed, "failed")
+}
+
+// Progress returns the startup progress of the instances of the node, for
+// each ARA
+func (s *Service) Progress() []ARAProgress {
+	s.progressMutex.Lock()
+	defer s.progressMutex.Unlock()
+	progress := make([]ARAProgress, 0, len(s.progress))
+	for _, p := range s.progress {
+		progress = append(progress, *p)
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		return progress[i].Secret < progress[j].Secret
+	})
+	return progress
+}
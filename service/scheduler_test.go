@@ -0,0 +1,78 @@
+package service
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFreePorts(t *testing.T) {
+	used := map[int]bool{100: true, 102: true}
+	reserved := map[int]bool{101: true, 104: true}
+	ports, err := freePorts(100, 110, 3, used, reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range []int{103, 105, 106} {
+		if ports[i] != p {
+			t.Fatal("wrong free ports", ports)
+		}
+	}
+
+	// the bounds of the range are included
+	ports, err = freePorts(100, 105, 2, used, reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ports[0] != 103 || ports[1] != 105 {
+		t.Fatal("wrong free ports", ports)
+	}
+
+	if _, err := freePorts(100, 105, 3, used, reserved); err == nil {
+		t.Fatal("no error when the range is exhausted")
+	}
+}
+
+func TestReservePorts(t *testing.T) {
+	s := &Service{PortMutex: &sync.Mutex{}, MinPort: 30000, MaxPort: 30020}
+
+	first, err := s.reservePorts(IPFSPortNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.reservePorts(ClusterPortNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]bool)
+	for _, p := range append(append([]int{}, first...), second...) {
+		if seen[p] {
+			t.Fatal("port", p, "reserved twice")
+		}
+		if p < s.MinPort || p > s.MaxPort {
+			t.Fatal("port", p, "out of the range of the node")
+		}
+		seen[p] = true
+	}
+
+	// released ports can be reserved again
+	s.releasePorts(first...)
+	if len(s.reservedPorts) != ClusterPortNumber {
+		t.Fatal("ports not released:", s.reservedPorts)
+	}
+	third, err := s.reservePorts(IPFSPortNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range third {
+		for _, q := range second {
+			if p == q {
+				t.Fatal("port", p, "reserved twice")
+			}
+		}
+	}
+
+	// the whole range cannot be reserved
+	if _, err := s.reservePorts(s.MaxPort - s.MinPort); err == nil {
+		t.Fatal("no error when the range is exhausted")
+	}
+}
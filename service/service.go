@@ -43,8 +43,13 @@ func init() {
 		ClusterBootstrapReply{},
 		StartARAAnnounce{},
 		StartARAReply{},
+		StartARABootstrap{},
 		StartInstancesAnnounce{},
 		StartInstancesReply{},
+		StopInstancesAnnounce{},
+		StopInstancesReply{},
+		HealthAnnounce{},
+		HealthReply{},
 		&storage{},
 	} {
 		network.RegisterMessage(i)
@@ -113,7 +118,6 @@ func (s *Service) setup(req *InitRequest) {
 		}
 	}
 
-	s.PortMutex = &sync.Mutex{}
 	s.metrics = make(map[string]*monitor.TimeMeasure)
 
 	s.OwnPings = make(map[string]float64)
@@ -121,14 +125,27 @@ func (s *Service) setup(req *InitRequest) {
 
 	s.OnetTree = req.OnetTree
 
-	myip := strings.Split(s.ServerIdentity().String(), "/")
-	myip = strings.Split(myip[len(myip)-1], ":")
-	s.MyIP = myip[0]
+	s.MyIP = s.ServerIdentity().Address.Host()
 
 	s.Name = s.Nodes.GetServerIdentityToName(s.ServerIdentity())
 
+	if req.BindSubnet != "" {
+		ips := make([]string, 0)
+		if n := s.Nodes.GetByName(s.Name); n != nil {
+			ips = n.IPs()
+		}
+		ip, err := bindIP(req.BindSubnet, ips)
+		if err != nil {
+			log.Error(s.Name, "binds instances to", s.MyIP+":", err)
+		} else {
+			s.MyIP = ip
+		}
+	}
+
 	_, err := os.Stat(PingsFile)
+	s.startMeasure(pingsMeasure, pingsMeasure)
 	s.getPings(err == nil && !req.ComputePings)
+	s.recordMeasure(pingsMeasure)
 	//os.IsNotExist(err))
 
 	//s.getPings(false)
@@ -137,7 +154,43 @@ func (s *Service) setup(req *InitRequest) {
 		s.printPings()
 	}
 
-	s.setIPFSVariables()
+	// a node that cannot be set up reports the error when its instances
+	// are started
+	s.setupErr = s.setIPFSVariables()
+	if s.setupErr != nil {
+		log.Error(s.Name, "cannot be set up:", s.setupErr)
+	}
+	profiles, err := ParseClusterProfiles(req)
+	if err != nil && s.setupErr == nil {
+		log.Error(s.Name, "cannot be set up:", err)
+		s.setupErr = err
+	}
+	s.ClusterProfiles = profiles
+	s.SharedIPFS = req.SharedIPFS
+	s.PrivateIPFS = req.PrivateIPFS
+	s.IPFSRouting = req.IPFSRouting
+	s.Addrs = DefaultAddrConfig()
+	s.Addrs.Family = req.AddrFamily
+	if req.SwarmTransport != "" {
+		s.Addrs.SwarmTransport = req.SwarmTransport
+	}
+	if req.MaxConcurrentStarts == 0 {
+		req.MaxConcurrentStarts = DefaultMaxConcurrentStarts
+	}
+	s.setStartConcurrency(req.MaxConcurrentStarts)
+	if req.Relaunch.Attempts > 0 {
+		s.Relaunch = req.Relaunch
+	}
+	if s.SharedIPFS && s.PrivateIPFS {
+		log.Lvl1("A shared ipfs instance cannot join the private networks " +
+			"of all ARAs, private networks are disabled")
+		s.PrivateIPFS = false
+	}
+	if s.PrivateIPFS && s.Addrs.SwarmTransport == "quic" {
+		log.Lvl1("QUIC does not support private networks, the ipfs swarm " +
+			"uses tcp")
+		s.Addrs.SwarmTransport = "tcp"
+	}
 
 	if !req.Cruxified {
 		return
@@ -151,9 +204,11 @@ func (s *Service) setup(req *InitRequest) {
 	}
 	maxLvl++
 
+	s.startMeasure(araGenerationMeasure, araGenerationMeasure)
 	AuxNodes, dist2, ARATreeStruct, ARAOnetTrees := gentree.GenARAs(s.Nodes,
 		s.Nodes.GetServerIdentityToName(s.ServerIdentity()),
 		s.PingDistances, maxLvl)
+	s.recordMeasure(araGenerationMeasure)
 
 	s.Distances = dist2
 	s.Nodes = AuxNodes
@@ -209,7 +264,10 @@ func newService(c *onet.Context) (onet.Service, error) {
 
 	s := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
+		PortMutex:        &sync.Mutex{},
+		Relaunch:         DefaultRelaunchPolicy(),
 	}
+	s.SetBackend(NewExecBackend())
 	log.ErrFatal(s.RegisterHandlers(s.InitRequest))
 
 	s.RegisterProcessorFunc(execReqPingsMsgID, s.ExecReqPings)
@@ -218,6 +276,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 	_, err := s.ProtocolRegister(StartIPFSName, func(n *onet.TreeNodeInstance) (
 		onet.ProtocolInstance, error) {
 
+		s.countProtocol()
 		return NewStartIPFSProtocol(n, s.GetService)
 	})
 	if err != nil {
@@ -228,6 +287,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 	_, err = s.ProtocolRegister(ClusterBootstrapName,
 		func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 
+			s.countProtocol()
 			return NewClusterBootstrapProtocol(n, s.GetService)
 		})
 	if err != nil {
@@ -238,6 +298,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 	_, err = s.ProtocolRegister(StartARAName,
 		func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 
+			s.countProtocol()
 			return NewStartARAProtocol(n, s.GetService)
 		})
 	if err != nil {
@@ -248,6 +309,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 	_, err = s.ProtocolRegister(StartInstancesName,
 		func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 
+			s.countProtocol()
 			return NewStartInstancesProtocol(n, s.GetService)
 		})
 	if err != nil {
@@ -255,19 +317,44 @@ func newService(c *onet.Context) (onet.Service, error) {
 		return nil, err
 	}
 
+	_, err = s.ProtocolRegister(StopInstancesName,
+		func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+
+			s.countProtocol()
+			return NewStopInstancesProtocol(n, s.GetService)
+		})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	_, err = s.ProtocolRegister(HealthName,
+		func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+
+			s.countProtocol()
+			return NewHealthProtocol(n, s.GetService)
+		})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
 	if err = s.tryLoad(); err != nil {
 		log.Error(err)
 		return nil, err
 	}
+	s.recoverInstances()
 
 	return s, nil
 }
 
-func (s *Service) getNodeID() int {
-	n, err := strconv.Atoi(s.Nodes.GetServerIdentityToName(
-		s.ServerIdentity())[len(NodeName):])
-	checkErr(err)
-	return n
+// getNodeID returns the number of the node in its name, e.g. 3 for node_3
+func (s *Service) getNodeID() (int, error) {
+	name := s.Nodes.GetServerIdentityToName(s.ServerIdentity())
+	if !strings.HasPrefix(name, NodeName) {
+		return 0, errors.New("invalid node name " + name)
+	}
+	return strconv.Atoi(name[len(NodeName):])
 }
 
 // GetService Returns the Current SERVICE
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+var tSuite = suites.MustFind("Ed25519")
+
+func TestMain(m *testing.M) {
+	// started when loading the ipfs-cluster packages
+	log.AddUserUninterestingGoroutine("go-log/writer.(*MirrorWriter)")
+	log.AddUserUninterestingGoroutine("opencensus.io/stats/view.(*worker)")
+	log.MainTest(m)
+}
+
+// newTestServices returns the services of n local conodes sharing the same
+// FakeBackend, each node being the root of an ARA made of all the nodes, the
+// onet tree of the conodes and the folder of their repos
+func newTestServices(t *testing.T, local *onet.LocalTest, n int) (
+	[]*Service, *onet.Tree, *FakeBackend, string) {
+
+	servers, roster, tree := local.GenTree(n, true)
+	dir, err := ioutil.TempDir("", "cruxipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[network.ServerIdentityID]string)
+	for i, si := range roster.List {
+		names[si.ID] = NodeName + strconv.Itoa(i)
+	}
+
+	backend := NewFakeBackend()
+	services := make([]*Service, n)
+	for i, srv := range local.GetServices(servers, templateID) {
+		s := srv.(*Service)
+		s.Name = names[s.ServerIdentity().ID]
+		s.Nodes.ServerIdentityToName = names
+		s.MyIP = "127.0.0.1"
+		s.Addrs = DefaultAddrConfig()
+		s.ConfigPath = filepath.Join(dir, s.Name)
+		s.MyIPFSPath = filepath.Join(s.ConfigPath, IPFSFolder)
+		s.MinPort = BaseHostPort + i*MaxPortNumberPerHost
+		s.MaxPort = s.MinPort + MaxPortNumberPerHost
+		ara := roster.NewRosterWithRoot(s.ServerIdentity()).GenerateBinaryTree()
+		s.BinaryTree = map[string][]*onet.Tree{s.Name: {ara}}
+		s.ClusterProfiles = []ClusterProfile{DefaultClusterProfile()}
+		s.SetBackend(backend)
+		services[i] = s
+	}
+	return services, tree, backend, dir
+}
+
+// startInstances starts the ARAs of all the nodes of the tree
+func startInstances(t *testing.T, s *Service,
+	tree *onet.Tree) *StartInstancesProtocol {
+
+	pi, err := s.CreateProtocol(StartInstancesName, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pi.(*StartInstancesProtocol)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Ready
+	return p
+}
+
+// health collects the health of the ARAs of all the nodes of the tree
+func health(t *testing.T, s *Service, tree *onet.Tree) *HealthProtocol {
+	pi, err := s.CreateProtocol(HealthName, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pi.(*HealthProtocol)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Ready
+	return p
+}
+
+// stopInstances stops the instances of all the nodes of the tree
+func stopInstances(t *testing.T, s *Service,
+	tree *onet.Tree) *StopInstancesProtocol {
+
+	pi, err := s.CreateProtocol(StopInstancesName, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pi.(*StopInstancesProtocol)
+	p.Clean = true
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Ready
+	return p
+}
+
+// startedInstances returns the started instances of the backend, per ARA
+// secret
+func startedInstances(b *FakeBackend) map[string][]*Instance {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	aras := make(map[string][]*Instance)
+	for _, fi := range b.instances {
+		if fi.started {
+			aras[fi.instance.Secret] = append(aras[fi.instance.Secret],
+				fi.instance)
+		}
+	}
+	return aras
+}
+
+func TestStartInstances(t *testing.T) {
+	n := 4
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	services, tree, backend, dir := newTestServices(t, local, n)
+	defer os.RemoveAll(dir)
+
+	p := startInstances(t, services[0], tree)
+	if !p.Success {
+		t.Fatal("start failed:", p.Report)
+	}
+	if len(p.Report) != n || len(p.Nodes) != n {
+		t.Fatal("expected", n, "nodes, got", len(p.Report), "reports and",
+			len(p.Nodes), "nodes")
+	}
+	for name, node := range p.Nodes {
+		if len(node.Clusters) != 1 {
+			t.Fatal(name, "is the root of", len(node.Clusters), "ARAs")
+		}
+		c := node.Clusters[0]
+		if c.Leader != name || c.Size != n || len(c.Instances) != n {
+			t.Fatal("wrong ARA of", name, c.Leader, c.Size,
+				len(c.Instances))
+		}
+	}
+
+	// each member of an ARA runs an ipfs and a cluster instance
+	aras := startedInstances(backend)
+	if len(aras) != n {
+		t.Fatal(len(aras), "ARAs running instead of", n)
+	}
+	for secret, instances := range aras {
+		if len(instances) != 2*n {
+			t.Fatal("ARA", secret, "runs", len(instances), "instances")
+		}
+	}
+	for _, s := range services {
+		if len(s.Instances) != 2*n {
+			t.Fatal(s.Name, "runs", len(s.Instances), "instances")
+		}
+	}
+}
+
+func TestFakeBackendContent(t *testing.T) {
+	n := 3
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	services, tree, backend, dir := newTestServices(t, local, n)
+	defer os.RemoveAll(dir)
+
+	startInstances(t, services[0], tree)
+	var ara, other []*Instance
+	for _, instances := range startedInstances(backend) {
+		if ara == nil {
+			ara = instances
+		} else {
+			other = instances
+		}
+	}
+
+	// content added to an instance is available in its ARA only
+	cid, err := backend.Add(ara[0], []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := backend.Cat(ara[len(ara)-1], cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Fatal("wrong content", string(data))
+	}
+	if _, err := backend.Cat(other[0], cid); err == nil {
+		t.Fatal("content found in another ARA")
+	}
+	if err := backend.Pin(other[0], cid); err == nil {
+		t.Fatal("content pinned in another ARA")
+	}
+	if err := backend.Pin(ara[1], cid); err != nil {
+		t.Fatal(err)
+	}
+	if pins := backend.Pins(ara[1], cid); len(pins) != 2 {
+		t.Fatal("wrong pins", pins)
+	}
+
+	// stopped instances do not serve content
+	if err := backend.Stop(ara[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Cat(ara[1], cid); err == nil {
+		t.Fatal("content served by a stopped instance")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	n := 4
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	services, tree, backend, dir := newTestServices(t, local, n)
+	defer os.RemoveAll(dir)
+
+	if p := startInstances(t, services[0], tree); !p.Success {
+		t.Fatal("start failed:", p.Report)
+	}
+	p := health(t, services[0], tree)
+	if !p.Healthy {
+		t.Fatal("ARAs not healthy:", p.Report)
+	}
+	if len(p.Report) != n {
+		t.Fatal("expected", n, "ARAs, got", len(p.Report))
+	}
+	for _, a := range p.Report {
+		if a.Size != n || a.ReadyPeers != n || a.ReadyIPFS != n {
+			t.Fatal("ARA of", a.Leader, "has", a.ReadyPeers, "cluster peers",
+				"and", a.ReadyIPFS, "ipfs instances ready out of", a.Size)
+		}
+		if len(a.RaftLeaders) != 1 || a.ConsensusPeers != n {
+			t.Fatal("ARA of", a.Leader, "has the raft leaders", a.RaftLeaders,
+				"and", a.ConsensusPeers, "consensus peers")
+		}
+	}
+
+	// a stopped cluster peer breaks its ARAs
+	s := services[1]
+	for _, i := range s.Instances {
+		if i.Kind == ClusterKind {
+			if err := backend.Stop(i); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	p = health(t, services[0], tree)
+	if p.Healthy {
+		t.Fatal("ARAs healthy with a stopped cluster peer")
+	}
+	unreachable := 0
+	for _, a := range p.Report {
+		if !a.Healthy {
+			if len(a.Unreachable) != 1 || a.Unreachable[0] != s.Name {
+				t.Fatal("wrong unreachable peers", a.Unreachable)
+			}
+			unreachable++
+		}
+	}
+	if unreachable != 1 {
+		t.Fatal(unreachable, "ARAs not healthy instead of 1")
+	}
+}
+
+func TestStopInstances(t *testing.T) {
+	n := 4
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	services, tree, backend, dir := newTestServices(t, local, n)
+	defer os.RemoveAll(dir)
+
+	if p := startInstances(t, services[0], tree); !p.Success {
+		t.Fatal("start failed:", p.Report)
+	}
+	paths := make([]string, 0)
+	for _, s := range services {
+		for _, i := range s.Instances {
+			paths = append(paths, i.Path)
+		}
+	}
+	p := stopInstances(t, services[0], tree)
+	if len(p.Report) != n {
+		t.Fatal("expected", n, "reports, got", len(p.Report))
+	}
+	for name, r := range p.Report {
+		if !r.Success || r.Stopped != 2*n {
+			t.Fatal(name, "stopped", r.Stopped, "instances:", r.Errors)
+		}
+	}
+	for _, s := range services {
+		if len(s.Instances) != 0 || len(s.reservedPorts) != 0 {
+			t.Fatal(s.Name, "still has instances or reserved ports")
+		}
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatal("repo", path, "not removed")
+		}
+	}
+	if aras := startedInstances(backend); len(aras) != 0 {
+		t.Fatal("instances of", len(aras), "ARAs still running")
+	}
+
+	// no ARA is left
+	if h := health(t, services[0], tree); h.Healthy || len(h.Report) != 0 {
+		t.Fatal("ARAs left after the stop:", h.Report)
+	}
+}
+
+func TestStopInstancesHangingLeaf(t *testing.T) {
+	n := 7
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	services, tree, backend, dir := newTestServices(t, local, n)
+	defer os.RemoveAll(dir)
+
+	if p := startInstances(t, services[0], tree); !p.Success {
+		t.Fatal("start failed:", p.Report)
+	}
+	if subtreeHeight(tree.Root) != 2 {
+		t.Fatal("expected a tree of height 2")
+	}
+	leaf := services[0].Nodes.GetServerIdentityToName(
+		tree.Root.Children[0].Children[0].ServerIdentity)
+	release := backend.Stall(leaf)
+
+	pi, err := services[0].CreateProtocol(StopInstancesName, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pi.(*StopInstancesProtocol)
+	p.Timeout = 3 * time.Second
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Ready
+	release()
+
+	// the parent of the leaf times out first and reports only the leaf
+	if len(p.Report) != n {
+		t.Fatal("expected", n, "reports, got", len(p.Report))
+	}
+	for name, r := range p.Report {
+		if (name == leaf) == r.Success {
+			t.Fatal("wrong report of", name, r.Success, r.Errors)
+		}
+	}
+
+	// wait for the leaf to stop its instances
+	for len(startedInstances(backend)) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRelaunch(t *testing.T) {
+	n := 3
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	services, tree, backend, dir := newTestServices(t, local, n)
+	defer os.RemoveAll(dir)
+
+	if p := startInstances(t, services[0], tree); !p.Success {
+		t.Fatal("start failed:", p.Report)
+	}
+	s := services[1]
+	s.Relaunch = RelaunchPolicy{Attempts: 2, Backoff: time.Millisecond}
+	var crashed *Instance
+	for _, i := range s.Instances {
+		if i.Kind == ClusterKind {
+			crashed = i
+			break
+		}
+	}
+
+	// the crashed instance is relaunched at the first attempt
+	if err := backend.Stop(crashed); err != nil {
+		t.Fatal(err)
+	}
+	s.instanceCrashed(crashed, errors.New("killed"))
+	if !backend.Ready(crashed) {
+		t.Fatal("crashed instance not relaunched")
+	}
+
+	// all attempts fail on an instance that cannot start
+	s.instanceCrashed(crashed, errors.New("killed"))
+	crashes := s.Crashes()
+	if len(crashes) != 2 || !crashes[0].Recovered ||
+		crashes[0].Attempts != 1 || crashes[1].Recovered ||
+		crashes[1].Attempts != 2 {
+		t.Fatal("wrong crash events", crashes)
+	}
+
+	p := health(t, services[0], tree)
+	a, ok := p.Report[crashed.Secret]
+	if !ok || a.Crashes != 2 || a.FailedRelaunches != 2 {
+		t.Fatal("wrong relaunch report", a)
+	}
+}
+
+func TestStartIPFSShared(t *testing.T) {
+	n := 4
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	services, tree, _, dir := newTestServices(t, local, n)
+	defer os.RemoveAll(dir)
+
+	// the clusters are only started on the children of the root
+	flat := tree.Roster.GenerateNaryTree(n - 1)
+	pi, err := services[0].CreateProtocol(StartIPFSName, flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pi.(*StartIPFSProtocol)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Ready
+	if !p.Success {
+		t.Fatal("start failed:", p.Report)
+	}
+	for _, s := range services {
+		for _, i := range s.Instances {
+			if i.Kind == IPFSKind &&
+				i.Path != s.MyIPFSPath+"-"+SharedIPFSSuffix {
+				t.Fatal("shared ipfs instance of", s.Name, "at", i.Path)
+			}
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package service
 
 import (
-	"strconv"
+	"errors"
+	"time"
 
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
 )
 
 // Check that *StartIPFSProtocol implements onet.ProtocolInstance
@@ -17,8 +19,11 @@ func NewStartARAProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 		TreeNodeInstance: n,
 		Ready:            make(chan bool),
 		GetService:       getServ,
+		Timeout:          ProtocolTimeout,
 	}
-	if err := n.RegisterChannels(&t.announceChan, &t.repliesChan); err != nil {
+	err := n.RegisterChannels(&t.announceChan, &t.repliesChan,
+		&t.bootstrapChan)
+	if err != nil {
 		return nil, err
 	}
 	return t, nil
@@ -27,7 +32,7 @@ func NewStartARAProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 // Start sends the Announce-message to all children
 func (p *StartARAProtocol) Start() error {
 	log.Lvl2("Starting an ARA with root", p.GetService().Name)
-	return p.SendTo(p.TreeNode(), &StartARAAnnounce{})
+	return p.SendTo(p.TreeNode(), &StartARAAnnounce{Timeout: p.Timeout})
 }
 
 // Dispatch implements the main logic of the protocol. The function is only
@@ -36,61 +41,139 @@ func (p *StartARAProtocol) Start() error {
 func (p *StartARAProtocol) Dispatch() error {
 	defer p.Done()
 
-	ann := <-p.announceChan
 	s := p.GetService()
+	var ann announceWrapperStartARA
+	select {
+	case ann = <-p.announceChan:
+	case <-time.After(p.Timeout):
+		return errors.New(s.Name + " got no " + StartARAName +
+			" announce after " + p.Timeout.String())
+	}
+	p.Timeout = ann.Timeout
+	deadline := time.Now().Add(p.Timeout)
+	height := subtreeHeight(p.TreeNode())
+	round := monitor.NewTimeMeasure(roundMeasurePrefix + StartARAName)
 
 	if p.IsRoot() {
-		// generate secret
-		secret := genSecret()
+		// the root generates the secret and starts as the ARA bootstrap
+		ann.SenderName = s.Name
+		ann.Secret = genSecret()
+		ann.Profile = p.Profile
+		ann.Designated = true
+	}
 
-		// starting IPFS and cluster instance
-		instance := s.StartIPFSAndCluster(s.Name, secret, "")
+	// starting IPFS and cluster instance, a designated node is the ARA
+	// bootstrap and doesn't bootstrap to anyone
+	bootstraps := ann.Bootstraps
+	if ann.Designated {
+		bootstraps = nil
+	}
+	instance, err := s.StartIPFSAndCluster(ann.SenderName, ann.Secret,
+		bootstraps, ann.IPFSBootstrap, &ann.Profile)
+	status := newNodeStatus(s.Name)
 
-		// adding information to cluster info
-		p.Info = ClusterInfo{
-			Leader:    s.Name,
-			Secret:    secret,
-			Instances: make([]ClusterInstance, 1),
+	// candidate bootstrap peers for the children
+	fwd := ann.StartARAAnnounce
+	fwd.Designated = false
+	children := p.Children()
+	if err != nil {
+		err = errors.New("failed to join the ARA of " + ann.SenderName + ": " +
+			err.Error())
+		log.Error(s.Name, err)
+		status.addError(err)
+		if ann.Designated {
+			// find a new bootstrap in the subtree
+			ann := fwd
+			ann.Designated = true
+			ann.Bootstraps = nil
+			fwd.Bootstraps, fwd.IPFSBootstrap, children = designate(
+				p.TreeNodeInstance, p.bootstrapChan,
+				levelTimeout(deadline, height), ann.SenderName,
+				func(c *onet.TreeNode) error {
+					ann.Timeout = levelTimeout(deadline, height)
+					return p.SendTo(c, &ann)
+				})
 		}
-		p.Info.Instances[0] = *instance
+	} else if ann.Designated {
+		fwd.Bootstraps = []string{clusterBootstrapAddr(instance)}
+		fwd.IPFSBootstrap = []string{instance.IPFSSwarmAddr}
+	} else {
+		// fall back on this node if the previous candidates are down
+		fwd.Bootstraps = append(append([]string{}, ann.Bootstraps...),
+			clusterBootstrapAddr(instance))
+		fwd.IPFSBootstrap = append(append([]string{}, ann.IPFSBootstrap...),
+			instance.IPFSSwarmAddr)
+	}
 
-		if len(p.TreeNodeInstance.Children()) > 0 {
-			bootstrap := instance.IP + strconv.Itoa(instance.ClusterPort)
-			p.SendToChildren(&StartARAAnnounce{
-				SenderName: s.Name,
-				Bootstrap:  bootstrap,
-				Secret:     secret,
-			})
-			replies := <-p.repliesChan
-			for i := 0; i < len(replies); i++ {
-				p.Info.Instances = append(p.Info.Instances,
-					*replies[i].Cluster...)
-			}
+	if ann.Designated && !p.IsRoot() {
+		// tell the parent which bootstrap was started
+		b := &StartARABootstrap{}
+		if len(fwd.Bootstraps) > 0 {
+			b.Bootstrap = fwd.Bootstraps[0]
+			b.IPFSBootstrap = fwd.IPFSBootstrap[0]
 		}
-		p.Info.Size = len(p.Info.Instances)
-		p.Ready <- true
-		return nil
-	} else if !p.IsLeaf() {
-		// not root nor leaf
-		p.SendToChildren(&ann.StartARAAnnounce)
-		replies := <-p.repliesChan
+		if err := p.SendToParent(b); err != nil {
+			log.Error(err)
+		}
+	}
 
-		// bootstrap peer
-		instance := s.StartIPFSAndCluster(ann.SenderName, ann.Secret,
-			ann.Bootstrap)
+	instances := make([]ClusterInstance, 0)
+	if instance != nil {
+		instances = append(instances, *instance)
+	}
+	statuses := []NodeStatus{status}
+	if !p.IsLeaf() {
+		fwd.Timeout = levelTimeout(deadline, height)
+		for _, c := range children {
+			if err := p.SendTo(c, &fwd); err != nil {
+				log.Error(err)
+			}
+		}
 
-		instances := make([]ClusterInstance, 0)
-		for _, r := range replies {
-			instances = append(instances, *r.Cluster...)
+		// wait for children replies
+		replied := make(map[onet.TreeNodeID]bool)
+		timeout := time.After(time.Until(deadline))
+	wait:
+		for len(replied) < len(p.Children()) {
+			select {
+			case r := <-p.repliesChan:
+				replied[r.TreeNode.ID] = true
+				if r.Cluster != nil {
+					instances = append(instances, *r.Cluster...)
+				}
+				statuses = append(statuses, r.Status...)
+			case <-timeout:
+				statuses = append(statuses,
+					s.missingStatus(p.TreeNodeInstance, replied, p.Timeout)...)
+				break wait
+			}
 		}
-		instances = append(instances, *instance)
-		return p.SendToParent(&StartARAReply{Cluster: &instances})
 	}
-	// leaf
 
-	// bootstrap peer
-	instance := s.StartIPFSAndCluster(ann.SenderName, ann.Secret,
-		ann.Bootstrap)
-	return p.SendToParent(&StartARAReply{
-		Cluster: &[]ClusterInstance{*instance}})
+	if !p.IsRoot() {
+		return p.SendToParent(&StartARAReply{
+			Cluster: &instances,
+			Status:  statuses,
+		})
+	}
+
+	// root, adding information to cluster info
+	p.Info = ClusterInfo{
+		Leader:    s.Name,
+		Secret:    ann.Secret,
+		Size:      len(instances),
+		Members:   p.Tree().Size(),
+		Profile:   p.Profile,
+		Instances: instances,
+	}
+	p.Report, p.Success = mergeStatus(statuses)
+	logReport(StartARAName+" of "+s.Name, p.Report)
+	p.Quorum = len(instances) >= quorum(p.Tree().Size())
+	if !p.Quorum {
+		log.Error("ARA of", s.Name, "has no quorum:", len(instances), "/",
+			p.Tree().Size(), "members up")
+	}
+	round.Record()
+	p.Ready <- true
+	return nil
 }
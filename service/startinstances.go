@@ -1,11 +1,13 @@
 package service
 
 import (
-	"fmt"
+	"errors"
 	"sync"
+	"time"
 
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
 )
 
 // Check that *StartIPFSProtocol implements onet.ProtocolInstance
@@ -18,6 +20,7 @@ func NewStartInstancesProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 		TreeNodeInstance: n,
 		Ready:            make(chan bool),
 		GetService:       getServ,
+		Timeout:          ProtocolTimeout,
 	}
 	if err := n.RegisterChannels(&t.announceChan, &t.repliesChan); err != nil {
 		return nil, err
@@ -28,7 +31,8 @@ func NewStartInstancesProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 // Start sends the Announce-message to all children
 func (p *StartInstancesProtocol) Start() error {
 	log.Lvl1("Starting IPFS and IPFS-Cluster instances")
-	return p.SendTo(p.TreeNode(), &StartInstancesAnnounce{})
+	return p.SendTo(p.TreeNode(),
+		&StartInstancesAnnounce{Timeout: p.Timeout})
 }
 
 // Dispatch implements the main logic of the protocol. The function is only
@@ -38,71 +42,137 @@ func (p *StartInstancesProtocol) Dispatch() error {
 	defer p.Done()
 
 	s := p.GetService()
+	var ann announceWrapperStartInstances
+	select {
+	case ann = <-p.announceChan:
+	case <-time.After(p.Timeout):
+		return errors.New(s.Name + " got no " + StartInstancesName +
+			" announce after " + p.Timeout.String())
+	}
+	p.Timeout = ann.Timeout
+	deadline := time.Now().Add(p.Timeout)
+	height := subtreeHeight(p.TreeNode())
+	round := monitor.NewTimeMeasure(roundMeasurePrefix + StartInstancesName)
 	ipfs := IPFSInformation{Name: s.Name, IP: s.MyIP}
 
 	if !p.IsLeaf() {
 		// send request to children
-		p.SendToChildren(&StartInstancesAnnounce{})
+		p.SendToChildren(&StartInstancesAnnounce{
+			Timeout: levelTimeout(deadline, height),
+		})
+	}
 
-		nodeChan := make(chan NodeInfo, 1)
-		go func(c chan NodeInfo) {
-			// starting ARAs where node is leader
-			c <- NodeInfo{IPFS: ipfs, Clusters: s.startLocalInstances()}
-		}(nodeChan)
+	// starting ARAs where node is leader while the children start theirs,
+	// the ARA rounds are one level below the node
+	clusters, statuses := s.startLocalInstances(
+		levelTimeout(deadline, height+1))
+	nodes := []NodeInfo{{IPFS: ipfs, Clusters: clusters}}
 
+	if !p.IsLeaf() {
 		// wait for children replies
-		ipfsReplies := <-p.repliesChan
-		node := <-nodeChan
-
-		p.Nodes = make(map[string]*NodeInfo)
-		p.Nodes[s.Name] = &node
-		for i := 0; i < len(ipfsReplies); i++ {
-			p.Nodes[ipfsReplies[i].Node.IPFS.Name] = ipfsReplies[i].Node
+		replied := make(map[onet.TreeNodeID]bool)
+		timeout := time.After(time.Until(deadline))
+	wait:
+		for len(replied) < len(p.Children()) {
+			select {
+			case r := <-p.repliesChan:
+				replied[r.TreeNode.ID] = true
+				nodes = append(nodes, r.Nodes...)
+				statuses = append(statuses, r.Status...)
+			case <-timeout:
+				statuses = append(statuses,
+					s.missingStatus(p.TreeNodeInstance, replied, p.Timeout)...)
+				break wait
+			}
 		}
+	}
 
-		/*
-			if !p.IsRoot() {
-				return p.SendToParent(&StartInstancesReply{Node: &node})
-			}*/ // root
-
-		p.Ready <- true
+	if !p.IsRoot() {
+		// return the info to global tree root
+		return p.SendToParent(&StartInstancesReply{
+			Nodes:  nodes,
+			Status: statuses,
+		})
+	}
 
-		return nil
+	// root
+	p.Nodes = make(map[string]*NodeInfo)
+	for i := range nodes {
+		p.Nodes[nodes[i].IPFS.Name] = &nodes[i]
 	}
-	// node is a leaf of the global tree
+	p.Report, p.Success = mergeStatus(statuses)
+	logReport(StartInstancesName, p.Report)
 
-	// starting ARAs where node is leader
-	node := NodeInfo{IPFS: ipfs, Clusters: s.startLocalInstances()}
-	// return the info to global tree root
-	return p.SendToParent(&StartInstancesReply{Node: &node})
+	round.Record()
+	p.Ready <- true
+	return nil
+}
+
+// araRadius returns the radius of the i-th ARA rooted at the node
+func (s *Service) araRadius(i int) float64 {
+	trees := s.GraphTree[s.Name]
+	if i >= len(trees) {
+		return 0
+	}
+	return trees[i].Radius
 }
 
 // startInstances start all ipfs and ipfs cluter instances where each node is
-// the root
-func (s *Service) startLocalInstances() []ClusterInfo {
+// the root, giving timeout to each ARA round, and returns the started ARAs and
+// the status of their members
+func (s *Service) startLocalInstances(timeout time.Duration) ([]ClusterInfo,
+	[]NodeStatus) {
+
+	status := newNodeStatus(s.Name)
+	if s.recovered {
+		// the ARAs were started before the conode restarted
+		return s.araList(), []NodeStatus{status}
+	}
 	list := make([]ClusterInfo, 0)
+	statuses := make([]NodeStatus, 0)
 	listMutex := sync.Mutex{}
 	wg := sync.WaitGroup{}
 	// iterate over all ARA trees where the local node is the root
-	for _, tree := range s.BinaryTree[s.Name] {
+	for i, tree := range s.BinaryTree[s.Name] {
 		wg.Add(1)
-		go func(t *onet.Tree) {
+		go func(t *onet.Tree, profile ClusterProfile, radius float64) {
+			defer wg.Done()
 			pi, err := s.CreateProtocol(StartARAName, t)
-			checkErr(err)
+			if err != nil {
+				listMutex.Lock()
+				status.addError(err)
+				listMutex.Unlock()
+				return
+			}
+			pi.(*StartARAProtocol).Profile = profile
+			pi.(*StartARAProtocol).Timeout = timeout
 
 			// start the ARA
-			pi.Start()
+			if err := pi.Start(); err != nil {
+				listMutex.Lock()
+				status.addError(err)
+				listMutex.Unlock()
+				return
+			}
 			<-pi.(*StartARAProtocol).Ready
-			fmt.Println("slave started")
+			log.Lvl2("ARA of", s.Name, "started")
 
 			// append the newly started cluster information to the local list
 			// of clusters
 			listMutex.Lock()
-			list = append(list, pi.(*StartARAProtocol).Info)
+			info := pi.(*StartARAProtocol).Info
+			info.Radius = radius
+			list = append(list, info)
+			for _, st := range pi.(*StartARAProtocol).Report {
+				statuses = append(statuses, st)
+			}
 			listMutex.Unlock()
-			wg.Done()
-		}(tree)
+		}(tree, s.clusterProfile(i), s.araRadius(i))
 	}
 	wg.Wait()
-	return list
+	s.InstancesMutex.Lock()
+	s.ARAs = list
+	s.InstancesMutex.Unlock()
+	s.saveState()
+	return list, append(statuses, status)
 }
@@ -1,10 +1,13 @@
 package service
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
 )
 
 // Check that *StartIPFSProtocol implements onet.ProtocolInstance
@@ -17,6 +20,7 @@ func NewStartIPFSProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 		TreeNodeInstance: n,
 		Ready:            make(chan bool),
 		GetService:       getServ,
+		Timeout:          ProtocolTimeout,
 	}
 	if err := n.RegisterChannels(&t.announceChan, &t.repliesChan); err != nil {
 		return nil, err
@@ -27,7 +31,7 @@ func NewStartIPFSProtocol(n *onet.TreeNodeInstance, getServ FnService) (
 // Start sends the Announce-message to all children
 func (p *StartIPFSProtocol) Start() error {
 	log.Lvl1("Starting IPFS instances")
-	return p.SendTo(p.TreeNode(), &StartIPFSAnnounce{})
+	return p.SendTo(p.TreeNode(), &StartIPFSAnnounce{Timeout: p.Timeout})
 }
 
 // Dispatch implements the main logic of the protocol. The function is only
@@ -36,63 +40,86 @@ func (p *StartIPFSProtocol) Start() error {
 func (p *StartIPFSProtocol) Dispatch() error {
 	defer p.Done()
 
-	ann := <-p.announceChan
 	s := p.GetService()
+	ann, err := p.waitAnnounce()
+	if err != nil {
+		return err
+	}
+	round := monitor.NewTimeMeasure(roundMeasurePrefix + StartIPFSName)
+	deadline := time.Now().Add(ann.Timeout)
+	height := subtreeHeight(p.TreeNode())
 
 	if !p.IsLeaf() {
 		// send request to children
-		p.SendToChildren(&StartIPFSAnnounce{Message: "IPFS"})
+		p.SendToChildren(&StartIPFSAnnounce{
+			Message: "IPFS",
+			Timeout: levelTimeout(deadline, height),
+		})
 
-		// waitgroup to wait own ipfs instance
-		wg := sync.WaitGroup{}
-		wg.Add(1)
+		// start own ipfs instance while the children start theirs
+		errChan := make(chan error, 1)
 		go func() {
-			// start ipfs
-			s.StartIPFS("")
-			wg.Done()
+			errChan <- s.startNodeIPFS()
 		}()
 
 		// wait for children replies
-		ipfsReplies := <-p.repliesChan
-		wg.Wait()
+		ipfsReplies, statuses := p.collectReplies("IPFS", deadline)
+		statuses = append(statuses, newNodeStatus(s.Name, <-errChan))
 
 		p.Nodes = make(map[string]*NodeInfo)
-		p.Nodes[s.Name] = &NodeInfo{
-			IPFS:     s.MyIPFS[0],
-			Clusters: make([]ClusterInfo, 0),
-		}
-		for i := 0; i < len(ipfsReplies); i++ {
-			p.Nodes[ipfsReplies[i].IPFS.Name] = &NodeInfo{
-				IPFS:     *ipfsReplies[i].IPFS,
+		if len(s.MyIPFS) > 0 {
+			p.Nodes[s.Name] = &NodeInfo{
+				IPFS:     s.MyIPFS[0],
 				Clusters: make([]ClusterInfo, 0),
 			}
 		}
+		for _, r := range ipfsReplies {
+			if r.IPFS != nil {
+				p.Nodes[r.IPFS.Name] = &NodeInfo{
+					IPFS:     *r.IPFS,
+					Clusters: make([]ClusterInfo, 0),
+				}
+			}
+		}
 
 		if !p.IsRoot() {
-			return p.SendToParent(&StartIPFSReply{IPFS: &s.MyIPFS[0]})
+			return p.SendToParent(s.ipfsReply(statuses))
 		} // root
-		log.Lvl1("All IPFS instances started successfully")
+		log.Lvl1("IPFS instances started on", len(p.Nodes), "nodes")
 
 		// start cluster instances on the root
-		p.SendToChildren(&StartIPFSAnnounce{Message: "Clusters"})
+		deadline = time.Now().Add(p.Timeout)
+		p.SendToChildren(&StartIPFSAnnounce{
+			Message: "Clusters",
+			Timeout: levelTimeout(deadline, height),
+		})
 
-		wg.Add(1)
+		clustersChan := make(chan []ClusterInfo, 1)
+		statusChan := make(chan []NodeStatus, 1)
 		go func() {
-			p.Nodes[s.Name].Clusters = append(p.Nodes[s.Name].Clusters,
-				s.startClusters()...)
-			wg.Done()
+			clusters, st := s.startClusters(levelTimeout(deadline, height+1))
+			clustersChan <- clusters
+			statusChan <- st
 		}()
 		// wait for children replies
-		replies := <-p.repliesChan
-		wg.Wait()
+		replies, clusterStatuses := p.collectReplies("Clusters", deadline)
+		statuses = append(statuses, clusterStatuses...)
+		statuses = append(statuses, <-statusChan...)
+		if node, ok := p.Nodes[s.Name]; ok {
+			node.Clusters = append(node.Clusters, <-clustersChan...)
+		}
 		for _, r := range replies {
 			if r.Clusters != nil {
 				for _, c := range *(r.Clusters) {
-					p.Nodes[c.Leader].Clusters =
-						append(p.Nodes[c.Leader].Clusters, c)
+					if node, ok := p.Nodes[c.Leader]; ok {
+						node.Clusters = append(node.Clusters, c)
+					}
 				}
 			}
 		}
+		p.Report, p.Success = mergeStatus(statuses)
+		logReport(StartIPFSName, p.Report)
+		round.Record()
 		p.Ready <- true
 
 		return nil
@@ -101,36 +128,136 @@ func (p *StartIPFSProtocol) Dispatch() error {
 	// node is a leaf
 	if ann.Message == "IPFS" {
 		// start ipfs
-		s.StartIPFS("")
-		// send ok to parent when it's done
-		p.SendToParent(&StartIPFSReply{IPFS: &s.MyIPFS[0]})
-		ann = <-p.announceChan
+		err := s.startNodeIPFS()
+		// send the status to parent when it's done
+		p.SendToParent(s.ipfsReply([]NodeStatus{newNodeStatus(s.Name, err)}))
+		ann, err = p.waitAnnounce()
+		if err != nil {
+			return err
+		}
 		if ann.Message == "Clusters" {
-			info := s.startClusters()
-			return p.SendToParent(&StartIPFSReply{Clusters: &info})
+			deadline = time.Now().Add(ann.Timeout)
+			info, statuses := s.startClusters(levelTimeout(deadline, 1))
+			return p.SendToParent(&StartIPFSReply{
+				Message:  "Clusters",
+				Clusters: &info,
+				Status:   statuses,
+			})
 		}
 	}
 	return nil
 }
 
-func (s *Service) startClusters() []ClusterInfo {
+// waitAnnounce waits for the next announce, or returns an error after the
+// protocol timeout
+func (p *StartIPFSProtocol) waitAnnounce() (announceWrapperStartIPFS, error) {
+	select {
+	case ann := <-p.announceChan:
+		return ann, nil
+	case <-time.After(p.Timeout):
+		return announceWrapperStartIPFS{}, errors.New(p.GetService().Name +
+			" got no " + StartIPFSName + " announce after " +
+			p.Timeout.String())
+	}
+}
+
+// collectReplies waits for the replies of all children to the announce with
+// the given message, or until the deadline
+func (p *StartIPFSProtocol) collectReplies(message string,
+	deadline time.Time) ([]StartIPFSReply, []NodeStatus) {
+
+	replies := make([]StartIPFSReply, 0)
+	statuses := make([]NodeStatus, 0)
+	replied := make(map[onet.TreeNodeID]bool)
+	wait := time.Until(deadline)
+	timeout := time.After(wait)
+	for len(replied) < len(p.Children()) {
+		select {
+		case r := <-p.repliesChan:
+			if r.Message != message {
+				// late reply to a previous announce
+				continue
+			}
+			replied[r.TreeNode.ID] = true
+			replies = append(replies, r.StartIPFSReply)
+			statuses = append(statuses, r.Status...)
+		case <-timeout:
+			return replies, append(statuses, p.GetService().missingStatus(
+				p.TreeNodeInstance, replied, wait)...)
+		}
+	}
+	return replies, statuses
+}
+
+// ipfsReply returns the reply of the node to the "IPFS" announce
+func (s *Service) ipfsReply(statuses []NodeStatus) *StartIPFSReply {
+	reply := &StartIPFSReply{Message: "IPFS", Status: statuses}
+	if len(s.MyIPFS) > 0 {
+		reply.IPFS = &s.MyIPFS[0]
+	}
+	return reply
+}
+
+// startNodeIPFS starts the ipfs instance of the node, unless the instances of
+// the node were recovered after a restart
+func (s *Service) startNodeIPFS() error {
+	if s.recovered {
+		return nil
+	}
+	_, err := s.StartIPFS("")
+	return err
+}
+
+// startClusters starts all ipfs cluster instances where node is the root,
+// giving timeout to each ARA round, and returns the started ARAs and the
+// status of their members
+func (s *Service) startClusters(timeout time.Duration) ([]ClusterInfo,
+	[]NodeStatus) {
+
+	status := newNodeStatus(s.Name)
+	if s.recovered {
+		// the ARAs were started before the conode restarted
+		return s.araList(), []NodeStatus{status}
+	}
 	list := make([]ClusterInfo, 0)
+	statuses := make([]NodeStatus, 0)
 	listMutex := sync.Mutex{}
 	wg := sync.WaitGroup{}
 	// iterate over all ARA trees where node is the root
-	for _, tree := range s.BinaryTree[s.Name] {
+	for i, tree := range s.BinaryTree[s.Name] {
 		wg.Add(1)
-		go func(t *onet.Tree) {
+		go func(t *onet.Tree, profile ClusterProfile, radius float64) {
+			defer wg.Done()
 			pi, err := s.CreateProtocol(ClusterBootstrapName, t)
-			checkErr(err)
-			pi.Start()
+			if err != nil {
+				listMutex.Lock()
+				status.addError(err)
+				listMutex.Unlock()
+				return
+			}
+			pi.(*ClusterBootstrapProtocol).Profile = profile
+			pi.(*ClusterBootstrapProtocol).Timeout = timeout
+			if err := pi.Start(); err != nil {
+				listMutex.Lock()
+				status.addError(err)
+				listMutex.Unlock()
+				return
+			}
 			<-pi.(*ClusterBootstrapProtocol).Ready
 			listMutex.Lock()
-			list = append(list, pi.(*ClusterBootstrapProtocol).Info)
+			info := pi.(*ClusterBootstrapProtocol).Info
+			info.Radius = radius
+			list = append(list, info)
+			for _, st := range pi.(*ClusterBootstrapProtocol).Report {
+				statuses = append(statuses, st)
+			}
 			listMutex.Unlock()
-			wg.Done()
-		}(tree)
+		}(tree, s.clusterProfile(i), s.araRadius(i))
 	}
 	wg.Wait()
-	return list
+	s.InstancesMutex.Lock()
+	s.ARAs = list
+	s.InstancesMutex.Unlock()
+	s.saveState()
+	return list, append(statuses, status)
 }
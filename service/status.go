@@ -0,0 +1,101 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// newNodeStatus returns the status of the node with the given name, failed if
+// any of the given errors is not nil
+func newNodeStatus(name string, errs ...error) NodeStatus {
+	st := NodeStatus{Name: name, Errors: make([]string, 0)}
+	for _, err := range errs {
+		if err != nil {
+			st.Errors = append(st.Errors, err.Error())
+		}
+	}
+	st.Success = len(st.Errors) == 0
+	return st
+}
+
+// addError marks the status as failed with the given error
+func (st *NodeStatus) addError(err error) {
+	st.Errors = append(st.Errors, err.Error())
+	st.Success = false
+}
+
+// missingStatus returns a failed status for each child of the node that did
+// not reply before the timeout
+func (s *Service) missingStatus(n *onet.TreeNodeInstance,
+	replied map[onet.TreeNodeID]bool, timeout time.Duration) []NodeStatus {
+
+	missing := make([]NodeStatus, 0)
+	for _, c := range n.Children() {
+		if replied[c.ID] {
+			continue
+		}
+		name := s.Nodes.GetServerIdentityToName(c.ServerIdentity)
+		missing = append(missing, NodeStatus{
+			Name:   name,
+			Errors: []string{"no reply after " + timeout.String()},
+		})
+	}
+	return missing
+}
+
+// subtreeHeight returns the number of levels below the tree node
+func subtreeHeight(t *onet.TreeNode) int {
+	height := 0
+	for _, c := range t.Children {
+		if h := subtreeHeight(c) + 1; h > height {
+			height = h
+		}
+	}
+	return height
+}
+
+// levelTimeout returns the time left before the deadline minus a margin for
+// each of the given levels, i.e. the time given to a subtree of that height
+// to reply, so that its nodes time out before the node waiting for them
+func levelTimeout(deadline time.Time, levels int) time.Duration {
+	left := time.Until(deadline)
+	if left < 0 {
+		return 0
+	}
+	return left * time.Duration(levels) / time.Duration(levels+1)
+}
+
+// mergeStatus aggregates the statuses by node name, and returns true if all
+// nodes succeeded
+func mergeStatus(statuses []NodeStatus) (map[string]NodeStatus, bool) {
+	report := make(map[string]NodeStatus)
+	success := true
+	for _, st := range statuses {
+		r, ok := report[st.Name]
+		if !ok {
+			r = NodeStatus{Name: st.Name, Success: true, Errors: []string{}}
+		}
+		r.Success = r.Success && st.Success
+		r.Errors = append(r.Errors, st.Errors...)
+		report[st.Name] = r
+		success = success && st.Success
+	}
+	return report, success
+}
+
+// logReport logs the errors of the nodes that failed during a protocol round
+func logReport(protocol string, report map[string]NodeStatus) {
+	names := make([]string, 0, len(report))
+	for name, st := range report {
+		if !st.Success {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Error(protocol, "failed on", name+":", report[name].Errors)
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/simul/monitor"
+)
+
+// Check that *StopInstancesProtocol implements onet.ProtocolInstance
+var _ onet.ProtocolInstance = (*StopInstancesProtocol)(nil)
+
+// NewStopInstancesProtocol initialises the structure for use in one round
+func NewStopInstancesProtocol(n *onet.TreeNodeInstance, getServ FnService) (
+	onet.ProtocolInstance, error) {
+	t := &StopInstancesProtocol{
+		TreeNodeInstance: n,
+		Ready:            make(chan bool),
+		GetService:       getServ,
+		Timeout:          ProtocolTimeout,
+	}
+	if err := n.RegisterChannels(&t.announceChan, &t.repliesChan); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Start sends the Announce-message to all children
+func (p *StopInstancesProtocol) Start() error {
+	log.Lvl1("Stopping IPFS and IPFS-Cluster instances")
+	return p.SendTo(p.TreeNode(), &StopInstancesAnnounce{
+		Clean:   p.Clean,
+		Timeout: p.Timeout,
+	})
+}
+
+// Dispatch implements the main logic of the protocol. The function is only
+// called once. The protocol is considered finished when Dispatch returns and
+// Done is called.
+func (p *StopInstancesProtocol) Dispatch() error {
+	defer p.Done()
+
+	s := p.GetService()
+	var ann announceWrapperStopInstances
+	select {
+	case ann = <-p.announceChan:
+	case <-time.After(p.Timeout):
+		return errors.New(s.Name + " got no " + StopInstancesName +
+			" announce after " + p.Timeout.String())
+	}
+	p.Timeout = ann.Timeout
+	deadline := time.Now().Add(p.Timeout)
+	round := monitor.NewTimeMeasure(roundMeasurePrefix + StopInstancesName)
+
+	reports := make([]NodeStopReport, 0)
+	if !p.IsLeaf() {
+		// send request to children
+		fwd := ann.StopInstancesAnnounce
+		fwd.Timeout = levelTimeout(deadline, subtreeHeight(p.TreeNode()))
+		p.SendToChildren(&fwd)
+	}
+
+	// stop own instances while the children are stopping theirs
+	reports = append(reports, s.stopLocalInstances(ann.Clean))
+
+	if !p.IsLeaf() {
+		// wait for children replies
+		replied := make(map[onet.TreeNodeID]bool)
+		timeout := time.After(time.Until(deadline))
+	wait:
+		for len(replied) < len(p.Children()) {
+			select {
+			case r := <-p.repliesChan:
+				replied[r.TreeNode.ID] = true
+				reports = append(reports, r.Nodes...)
+			case <-timeout:
+				for _, st := range s.missingStatus(p.TreeNodeInstance, replied,
+					p.Timeout) {
+					reports = append(reports, NodeStopReport{Name: st.Name,
+						Errors: st.Errors})
+				}
+				break wait
+			}
+		}
+	}
+
+	if !p.IsRoot() {
+		return p.SendToParent(&StopInstancesReply{Nodes: reports})
+	}
+
+	// root
+	p.Report = make(map[string]NodeStopReport)
+	p.Resources = ResourceReport{}
+	for _, r := range reports {
+		p.Report[r.Name] = r
+		p.Resources = p.Resources.Add(r.Resources)
+		if !r.Success {
+			log.Lvl1("Failed to stop all instances of", r.Name+":", r.Errors)
+		}
+		for _, c := range r.Crashes {
+			log.Lvl1("Crash of", c.Kind, "instance of", c.Node, "at", c.Time,
+				"downtime (ms):", c.Downtime, "recovered:", c.Recovered)
+		}
+	}
+	log.Lvl1("Stopped instances on", len(p.Report), "nodes")
+	log.Lvl1("Resources used by all instances:", p.Resources)
+	round.Record()
+	p.Ready <- true
+	return nil
+}
+
+// stopLocalInstances stops all ipfs and cluster instances owned by the node,
+// cluster instances first, and removes their repos if clean is set
+func (s *Service) stopLocalInstances(clean bool) NodeStopReport {
+	report := NodeStopReport{
+		Name:      s.Name,
+		Errors:    make([]string, 0),
+		Resources: s.ResourceUsage(),
+		Crashes:   s.Crashes(),
+	}
+
+	s.InstancesMutex.Lock()
+	instances := s.Instances
+	s.Instances = make([]*Instance, 0)
+	s.InstancesMutex.Unlock()
+
+	for _, kind := range []InstanceKind{ClusterKind, IPFSKind} {
+		for _, i := range instances {
+			if i.Kind != kind {
+				continue
+			}
+			if err := s.Backend.Stop(i); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			} else {
+				report.Stopped++
+			}
+			s.releasePorts(i.Ports...)
+			if clean {
+				if err := os.RemoveAll(i.Path); err != nil {
+					report.Errors = append(report.Errors, err.Error())
+				}
+			}
+		}
+	}
+	s.InstancesMutex.Lock()
+	s.MyIPFS = make([]IPFSInformation, 0)
+	s.ARAs = nil
+	s.InstancesMutex.Unlock()
+	s.sharedIPFSMutex.Lock()
+	s.sharedIPFS = nil
+	s.sharedIPFSMutex.Unlock()
+	s.recovered = false
+	s.crashMutex.Lock()
+	s.crashes = nil
+	s.restarts = nil
+	s.crashMutex.Unlock()
+	s.progressMutex.Lock()
+	s.progress = nil
+	s.progressMutex.Unlock()
+	s.saveState()
+
+	report.Success = len(report.Errors) == 0
+	log.Lvl2(s.Name, "stopped", report.Stopped, "instances")
+	s.ReportCounters()
+	return report
+}
+
+// addInstance registers a started instance owned by the node
+func (s *Service) addInstance(i *Instance) {
+	s.InstancesMutex.Lock()
+	s.Instances = append(s.Instances, i)
+	s.InstancesMutex.Unlock()
+	s.saveState()
+}
+
+// removeInstance unregisters an instance owned by the node
+func (s *Service) removeInstance(i *Instance) {
+	s.InstancesMutex.Lock()
+	for n, o := range s.Instances {
+		if o == i {
+			s.Instances = append(s.Instances[:n], s.Instances[n+1:]...)
+			break
+		}
+	}
+	s.InstancesMutex.Unlock()
+	s.saveState()
+}
+
+// araList returns a copy of the ARAs rooted at the node
+func (s *Service) araList() []ClusterInfo {
+	s.InstancesMutex.Lock()
+	defer s.InstancesMutex.Unlock()
+	return append([]ClusterInfo{}, s.ARAs...)
+}
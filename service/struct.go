@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/dedis/student_19_cruxIPFS/gentree"
 
@@ -32,18 +33,35 @@ type Service struct {
 	alive        bool
 	Distances    map[*gentree.LocalityNode]map[*gentree.LocalityNode]float64
 
-	PortMutex    *sync.Mutex
+	Backend        InstanceBackend // starts and stops ipfs and cluster instances
+	Instances      []*Instance     // instances owned by the node
+	InstancesMutex sync.Mutex
+	ARAs           []ClusterInfo // ARAs rooted at the node
+	recovered      bool          // instances recovered from the storage
+
+	crashes    []CrashEvent   // crashes of the instances of the node
+	restarts   map[string]int // repo path -> number of relaunches
+	crashMutex sync.Mutex
+	Relaunch   RelaunchPolicy // retries of the relaunch of a crashed instance
+
+	PortMutex    *sync.Mutex // protects the port reservations
 	W            *bufio.Writer
 	File         *os.File
 	metrics      map[string]*monitor.TimeMeasure
 	metricsMutex sync.Mutex
 
+	reservedPorts map[int]bool  // ports of the instances of the node
+	startSlots    chan struct{} // bounds the concurrent instance startups
+	progress      map[string]*ARAProgress
+	progressMutex sync.Mutex
+
 	BandwidthRx uint64
 	BandwidthTx uint64
 	NrMsgRx     uint64
 	NrMsgTx     uint64
 
 	NrProtocolsStarted uint64
+	counter            monitor.CounterIO // onet counters of the node
 
 	OwnPings      map[string]float64
 	DonePing      bool
@@ -53,7 +71,7 @@ type Service struct {
 	PingMapMtx    sync.Mutex
 
 	Name       string // name of the service (node_2)
-	MyIP       string // IP address
+	MyIP       string // IP address or dns name
 	ConfigPath string // path to home config folder
 	MyIPFSPath string // path to ipfs config folder of that service
 	MinPort    int    // port range allocated to this node
@@ -61,6 +79,16 @@ type Service struct {
 	MyIPFS     []IPFSInformation          // own ipfs information
 	OtherIPFS  map[string]IPFSInformation // node_x -> IP, ports etc.
 
+	ClusterProfiles []ClusterProfile // profiles of the ARAs rooted at node
+	Addrs           AddrConfig       // families and transports of addresses
+
+	SharedIPFS      bool      // single ipfs instance shared by all ARAs
+	sharedIPFS      *Instance // the shared ipfs instance once started
+	sharedIPFSMutex sync.Mutex
+	PrivateIPFS     bool   // one private ipfs network per ARA
+	IPFSRouting     string // routing mode of the ipfs instances
+	setupErr        error  // error of the setup, reported by the starts
+
 	OnetTree      *onet.Tree
 	StartIPFSProt onet.ProtocolInstance
 }
@@ -70,7 +98,14 @@ type FnService func() *Service
 
 // storage is used to save our data.
 type storage struct {
-	Count int
+	Name       string
+	ConfigPath string
+	MinPort    int
+	MaxPort    int
+	MyIPFS     []IPFSInformation
+	ARAs       []ClusterInfo // ARAs rooted at the node
+	Instances  []Instance    // instances owned by the node
+	SharedIPFS bool          // the ipfs instance is shared by all the ARAs
 	sync.Mutex
 }
 
@@ -78,18 +113,27 @@ type storage struct {
 type ClusterInfo struct {
 	Leader    string
 	Secret    string
-	Size      int
+	Size      int     // number of members whose cluster instance started
+	Members   int     // number of nodes of the ARA tree
+	Radius    float64 // radius of the ring of the ARA, in ms
+	Profile   ClusterProfile
 	Instances []ClusterInstance
 }
 
 // ClusterInstance details of a cluster
 type ClusterInstance struct {
 	HostName      string
-	IP            string
+	IP            string // host of the instance, ip or dns name
 	IPFSAPIAddr   string
+	IPFSSwarmAddr string // ipfs bootstrap address, including the peer id
+	GatewayAddr   string // http gateway of the ipfs instance
+	PeerID        string // cluster peer id
 	RestAPIPort   int
 	IPFSProxyPort int
 	ClusterPort   int
+	RestAPIAddr   string // multiaddress of the rest api listener
+	IPFSProxyAddr string // multiaddress of the ipfs proxy listener
+	ClusterAddr   string // multiaddress of the cluster listener
 }
 
 // IPFSInformation structure containing information about an IPFS instance
@@ -109,7 +153,38 @@ type InitRequest struct {
 	Roster               *onet.Roster
 	Cruxified            bool
 	ComputePings         bool
-	Mode                 string
+	// Mode cluster consensus of the ARAs, "raft", "crdt" or a comma separated
+	// list of both to mix them
+	Mode       string
+	ReplMin    int
+	ReplMax    int
+	Allocator  string
+	PinTracker string
+	// SharedIPFS run a single ipfs instance per node, shared by all the
+	// cluster instances of the node instead of one ipfs instance per ARA
+	SharedIPFS bool
+	// PrivateIPFS make the ipfs instances of each ARA a private network,
+	// bootstrapping only to ARA members, ignored if SharedIPFS is set
+	PrivateIPFS bool
+	// IPFSRouting routing mode of the ipfs instances, "dht", "dhtclient" or
+	// "none" to disable the DHT
+	IPFSRouting string
+	// MaxConcurrentStarts max number of instances started at the same time
+	// on a node, negative for no limit
+	MaxConcurrentStarts int
+	// AddrFamily "ip4", "ip6", "dns4" or "dns6", family of the addresses of
+	// the instances, derived from the conode address if empty
+	AddrFamily string
+	// SwarmTransport "tcp" or "quic", transport of the ipfs swarm, quic is
+	// not supported by private networks and falls back to tcp with PrivateIPFS
+	SwarmTransport string
+	// BindSubnet CIDR of the network the instances listen on (e.g. the
+	// experiment network rather than the control network), the conode
+	// address is used if empty
+	BindSubnet string
+	// Relaunch retries of the relaunch of a crashed instance, the default
+	// policy is used if no attempts are given
+	Relaunch RelaunchPolicy
 }
 
 // InitResponse packet
@@ -137,15 +212,21 @@ type NodeInfo struct {
 type StartIPFSProtocol struct {
 	*onet.TreeNodeInstance
 	announceChan chan announceWrapperStartIPFS
-	repliesChan  chan []replyWrapperStartIPFS
+	repliesChan  chan replyWrapperStartIPFS
 	Ready        chan bool
 	GetService   FnService
 	Nodes        map[string]*NodeInfo
+	Timeout      time.Duration         // max time to wait for a message
+	Report       map[string]NodeStatus // node name -> status of the node
+	Success      bool                  // all nodes succeeded
 }
 
 // StartIPFSAnnounce is used to pass a message to all children.
 type StartIPFSAnnounce struct {
 	Message string
+	// Timeout time left to the receiver to reply, shorter at each level so
+	// that the children time out before their parent
+	Timeout time.Duration
 }
 
 // announceWrapperWaitpeers just contains Announce and the data necessary to
@@ -157,8 +238,10 @@ type announceWrapperStartIPFS struct {
 
 // StartIPFSReply returns true when ready.
 type StartIPFSReply struct {
+	Message  string // message of the announce that is answered
 	IPFS     *IPFSInformation
 	Clusters *[]ClusterInfo
+	Status   []NodeStatus
 }
 
 // replyWrapper just contains Reply and the data necessary to identify and
@@ -171,18 +254,33 @@ type replyWrapperStartIPFS struct {
 // ClusterBootstrapProtocol structure
 type ClusterBootstrapProtocol struct {
 	*onet.TreeNodeInstance
-	announceChan chan announceWrapperClusterBootstrap
-	repliesChan  chan []replyWrapperClusterBootstrap
-	Ready        chan bool
-	Info         ClusterInfo
-	GetService   FnService
+	announceChan  chan announceWrapperClusterBootstrap
+	repliesChan   chan replyWrapperClusterBootstrap
+	bootstrapChan chan bootstrapWrapperStartARA
+	Ready         chan bool
+	Info          ClusterInfo
+	Profile       ClusterProfile
+	GetService    FnService
+	Timeout       time.Duration         // max time to wait for a message
+	Report        map[string]NodeStatus // node name -> status of the node
+	Success       bool                  // all nodes succeeded
 }
 
 // ClusterBootstrapAnnounce is used to pass a message to all children.
 type ClusterBootstrapAnnounce struct {
 	SenderName string
-	Bootstrap  string
+	Bootstraps []string // ordered candidate bootstrap peers
 	Secret     string
+	Profile    ClusterProfile
+	// Designated the receiver must start as the ARA bootstrap, because its
+	// parent could not start
+	Designated bool
+	// IPFSBootstrap ordered candidate ipfs bootstrap peers, only used by
+	// private ipfs networks
+	IPFSBootstrap []string
+	// Timeout time left to the receiver to reply, shorter at each level so
+	// that the children time out before their parent
+	Timeout time.Duration
 }
 
 // announceWrapperClusterBootstrap just contains Announce and the data necessary
@@ -195,6 +293,7 @@ type announceWrapperClusterBootstrap struct {
 // ClusterBootstrapReply returns true when ready.
 type ClusterBootstrapReply struct {
 	Cluster *[]ClusterInstance
+	Status  []NodeStatus
 }
 
 // replyWrapperClusterBootstrap just contains Reply and the data necessary to
@@ -207,18 +306,47 @@ type replyWrapperClusterBootstrap struct {
 // StartARAProtocol structure
 type StartARAProtocol struct {
 	*onet.TreeNodeInstance
-	announceChan chan announceWrapperStartARA
-	repliesChan  chan []replyWrapperStartARA
-	Ready        chan bool
-	Info         ClusterInfo
-	GetService   FnService
+	announceChan  chan announceWrapperStartARA
+	repliesChan   chan replyWrapperStartARA
+	bootstrapChan chan bootstrapWrapperStartARA
+	Ready         chan bool
+	Info          ClusterInfo
+	Profile       ClusterProfile
+	Quorum        bool // a quorum of the ARA members is up
+	GetService    FnService
+	Timeout       time.Duration         // max time to wait for a message
+	Report        map[string]NodeStatus // node name -> status of the node
+	Success       bool                  // all nodes succeeded
 }
 
 // StartARAAnnounce is used to pass a message to all children.
 type StartARAAnnounce struct {
-	SenderName string
-	Bootstrap  string
-	Secret     string
+	SenderName    string
+	Bootstraps    []string // ordered candidate bootstrap peers
+	IPFSBootstrap []string
+	Secret        string
+	Profile       ClusterProfile
+	// Designated the receiver must start as the ARA bootstrap, because its
+	// parent could not start
+	Designated bool
+	// Timeout time left to the receiver to reply, shorter at each level so
+	// that the children time out before their parent
+	Timeout time.Duration
+}
+
+// StartARABootstrap is sent by a designated node to its parent, with the
+// address of the bootstrap peer started in its subtree, empty if none. It is
+// used by StartARAProtocol and ClusterBootstrapProtocol.
+type StartARABootstrap struct {
+	Bootstrap     string
+	IPFSBootstrap string
+}
+
+// bootstrapWrapperStartARA just contains StartARABootstrap and the data
+// necessary to identify and process the message in onet.
+type bootstrapWrapperStartARA struct {
+	*onet.TreeNode
+	StartARABootstrap
 }
 
 // announceWrapperStartARA just contains Announce and the data necessary
@@ -231,6 +359,7 @@ type announceWrapperStartARA struct {
 // StartARAReply returns true when ready.
 type StartARAReply struct {
 	Cluster *[]ClusterInstance
+	Status  []NodeStatus
 }
 
 // replyWrapperStartARA just contains Reply and the data necessary to
@@ -244,14 +373,21 @@ type replyWrapperStartARA struct {
 type StartInstancesProtocol struct {
 	*onet.TreeNodeInstance
 	announceChan chan announceWrapperStartInstances
-	repliesChan  chan []replyWrapperStartInstances
+	repliesChan  chan replyWrapperStartInstances
 	Ready        chan bool
 	GetService   FnService
 	Nodes        map[string]*NodeInfo
+	Timeout      time.Duration         // max time to wait for a message
+	Report       map[string]NodeStatus // node name -> status of the node
+	Success      bool                  // all nodes succeeded
 }
 
 // StartInstancesAnnounce is used to pass a message to all children.
-type StartInstancesAnnounce struct{}
+type StartInstancesAnnounce struct {
+	// Timeout time left to the receiver to reply, shorter at each level so
+	// that the children time out before their parent
+	Timeout time.Duration
+}
 
 // announceWrapperStartInstances just contains Announce and the data necessary
 // to identify and process the message in onet.
@@ -260,9 +396,10 @@ type announceWrapperStartInstances struct {
 	StartInstancesAnnounce
 }
 
-// StartInstancesReply returns true when ready.
+// StartInstancesReply contains the instances of the nodes of the subtree.
 type StartInstancesReply struct {
-	Node *NodeInfo
+	Nodes  []NodeInfo
+	Status []NodeStatus
 }
 
 // replyWrapperStartInstances just contains Reply and the data necessary to
@@ -271,3 +408,185 @@ type replyWrapperStartInstances struct {
 	*onet.TreeNode
 	StartInstancesReply
 }
+
+// StopInstancesProtocol structure
+type StopInstancesProtocol struct {
+	*onet.TreeNodeInstance
+	announceChan chan announceWrapperStopInstances
+	repliesChan  chan replyWrapperStopInstances
+	Ready        chan bool
+	GetService   FnService
+	Clean        bool          // remove the repos of the stopped instances
+	Timeout      time.Duration // max time to wait for a message
+	Report       map[string]NodeStopReport
+	Resources    ResourceReport // total resources used by the instances
+}
+
+// StopInstancesAnnounce is used to pass a message to all children.
+type StopInstancesAnnounce struct {
+	Clean bool
+	// Timeout time left to the receiver to reply, shorter at each level so
+	// that the children time out before their parent
+	Timeout time.Duration
+}
+
+// announceWrapperStopInstances just contains Announce and the data necessary
+// to identify and process the message in onet.
+type announceWrapperStopInstances struct {
+	*onet.TreeNode
+	StopInstancesAnnounce
+}
+
+// StopInstancesReply contains the reports of the nodes of the subtree.
+type StopInstancesReply struct {
+	Nodes []NodeStopReport
+}
+
+// replyWrapperStopInstances just contains Reply and the data necessary to
+// identify and process the message in onet.
+type replyWrapperStopInstances struct {
+	*onet.TreeNode
+	StopInstancesReply
+}
+
+// NodeStatus result of a protocol round on a node, carried by the replies
+type NodeStatus struct {
+	Name    string
+	Success bool
+	Errors  []string
+}
+
+// NodeStopReport result of stopping the instances of a node
+type NodeStopReport struct {
+	Name      string
+	Success   bool
+	Stopped   int
+	Errors    []string
+	Resources ResourceReport // resources used before stopping
+	Crashes   []CrashEvent
+}
+
+// ResourceReport resources used by the instances of a node
+type ResourceReport struct {
+	IPFSDaemons    int
+	ClusterDaemons int
+	Ports          int
+	MemoryKiB      uint64
+}
+
+// HealthProtocol structure
+type HealthProtocol struct {
+	*onet.TreeNodeInstance
+	announceChan chan announceWrapperHealth
+	repliesChan  chan replyWrapperHealth
+	Ready        chan bool
+	GetService   FnService
+	Timeout      time.Duration         // max time to wait for a message
+	Report       map[string]*ARAHealth // ARA secret -> health of the ARA
+	Healthy      bool                  // all ARAs formed
+}
+
+// HealthAnnounce is used to pass a message to all children.
+type HealthAnnounce struct {
+	// Timeout time left to the receiver to reply, shorter at each level so
+	// that the children time out before their parent
+	Timeout time.Duration
+}
+
+// announceWrapperHealth just contains Announce and the data necessary to
+// identify and process the message in onet.
+type announceWrapperHealth struct {
+	*onet.TreeNode
+	HealthAnnounce
+}
+
+// HealthReply contains the health of the nodes of the subtree.
+type HealthReply struct {
+	Nodes []NodeHealth
+}
+
+// replyWrapperHealth just contains Reply and the data necessary to identify
+// and process the message in onet.
+type replyWrapperHealth struct {
+	*onet.TreeNode
+	HealthReply
+}
+
+// NodeHealth health of the instances owned by a node
+type NodeHealth struct {
+	Name      string
+	ARAs      []ClusterInfo // ARAs rooted at the node
+	Instances []InstanceHealth
+	Crashes   []CrashEvent
+	Progress  []ARAProgress
+	Error     string // set if the node did not reply
+}
+
+// InstanceHealth state of an instance, as reported by its API
+type InstanceHealth struct {
+	Kind   InstanceKind
+	Node   string
+	Secret string
+	PeerID string
+	Ready  bool
+	Peers  int // connected ipfs peers, or cluster peers including itself
+	Pins   int
+	Error  string
+	// ConsensusPeers size of the consensus peer set of a cluster peer
+	ConsensusPeers int
+	// Leader raft leader seen by a cluster peer, empty if unknown
+	Leader string
+}
+
+// ARAHealth health of an ARA, aggregated by the root of the onet tree
+type ARAHealth struct {
+	Leader      string
+	Secret      string
+	Consensus   string
+	Size        int      // expected number of cluster peers, the ARA members
+	ReadyIPFS   int      // ipfs instances answering on their API
+	ReadyPeers  int      // cluster peers answering on their API
+	MinPeers    int      // smallest peer set seen by a cluster peer
+	Pins        int      // largest pin count seen by a cluster peer
+	Unreachable []string // nodes whose cluster peer is not ready
+	Errors      []string
+	Healthy     bool
+	Starting    int // instances launched and not ready yet
+	Failed      int // instances that failed to start
+	// ConsensusPeers smallest consensus peer set seen by a cluster peer
+	ConsensusPeers int
+	// RaftLeaders distinct raft leaders seen by the cluster peers, a formed
+	// raft ARA has exactly one
+	RaftLeaders []string
+	Crashes     int // crashes of the instances of the ARA
+	// FailedRelaunches relaunch attempts of the crashed instances that failed
+	FailedRelaunches int
+}
+
+// ARAProgress startup progress of the instances of a node for an ARA
+type ARAProgress struct {
+	Secret  string
+	Started int // launched, not ready yet
+	Ready   int
+	Failed  int
+}
+
+// CrashEvent crash of an instance, and its relaunch
+type CrashEvent struct {
+	Node      string
+	Kind      InstanceKind
+	Secret    string
+	Path      string
+	Error     string
+	Time      int64  // unix time of the crash in milliseconds
+	Downtime  int64  // milliseconds until ready again, -1 if not recovered
+	Bootstrap string // address the relaunched cluster peer bootstrapped to
+	Attempts  int    // relaunch attempts, 0 if not relaunched
+	Recovered bool
+}
+
+// RelaunchPolicy retries of the relaunch of a crashed instance
+type RelaunchPolicy struct {
+	Attempts int           // max number of attempts
+	Backoff  time.Duration // wait before the first attempt, then doubled
+}
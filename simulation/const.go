@@ -2,8 +2,10 @@ package main
 
 import (
 	"path/filepath"
+	"time"
 
 	cruxIPFS "github.com/dedis/student_19_cruxIPFS"
+	"github.com/dedis/student_19_cruxIPFS/operations"
 )
 
 const (
@@ -15,6 +17,11 @@ const (
 	prescriptFile   = "prescript.sh"
 	nodesFile       = "nodes.txt"
 	detailsFile     = "details.txt"
+
+	// healthTimeout max time to wait for the ARAs to form
+	healthTimeout = 5 * time.Minute
+	// healthInterval time between two health checks of the ARAs
+	healthInterval = 10 * time.Second
 )
 
 var dataLocation string
@@ -28,10 +35,26 @@ var nodesLocation string
 var simdetailsLocation string
 
 var mode = "raft"
+var replMin = 0
+var replMax = 0
+var allocator = ""
+var pinTracker = ""
 var computePings = true
 var cruxified = true
 var remote = true
 var nOps = 100
+var sharedIPFS = false
+var privateIPFS = false
+var ipfsRouting = ""
+var concurrency = 0
+var addrFamily = ""
+var swarmTransport = ""
+var bindSubnet = ""
+var routedOps = false
+var contentConfig = operations.DefaultContentConfig()
+var workload = "test2"
+var workloadConfig = operations.DefaultWorkloadConfig(0, 0)
+var retryPolicy = operations.DefaultRetryPolicy()
 
 func init() {
 	dataLocation = filepath.Join(rootFolder, cruxIPFS.DataFolder)
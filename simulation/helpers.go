@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
@@ -43,7 +44,7 @@ func (s *IPFSSimulation) ReadNodesFromFile(filename string,
 		}
 
 		tokens := strings.Split(line, " ")
-		name, levelstr := tokens[0], tokens[4]
+		name, ips, levelstr := tokens[0], tokens[3], tokens[4]
 
 		level, err := strconv.Atoi(levelstr)
 
@@ -51,7 +52,7 @@ func (s *IPFSSimulation) ReadNodesFromFile(filename string,
 			log.Error(err)
 		}
 
-		myNode := gentree.CreateNode(name, level)
+		myNode := gentree.CreateNode(name, ips, level)
 		s.Nodes.All = append(s.Nodes.All, myNode)
 	}
 }
@@ -74,6 +75,9 @@ func (s *IPFSSimulation) initializeMaps(config *onet.SimulationConfig,
 		for _, treeNode := range config.Tree.List() {
 			serverIP := treeNode.ServerIdentity.Address.Host()
 			node := s.Nodes.GetByIP(serverIP)
+			if node == nil {
+				log.Fatal("No node with IP", serverIP, "in", nodesFile)
+			}
 			node.ServerIdentity = treeNode.ServerIdentity
 			s.Nodes.ServerIdentityToName[treeNode.ServerIdentity.ID] = node.Name
 			ServerIdentityToName[treeNode.ServerIdentity] = node.Name
@@ -83,42 +87,153 @@ func (s *IPFSSimulation) initializeMaps(config *onet.SimulationConfig,
 	return ServerIdentityToName
 }
 
+// parseParams reads the simulation parameters of the details file, one
+// key=value per line
 func parseParams() {
 	b, err := ioutil.ReadFile(detailsFile)
 	if err != nil {
 		panic(err)
 	}
-	truestr := "true"
 	for _, l := range strings.Split(string(b), "\n") {
-		if strings.Contains(l, "pings") {
-			if strings.Split(l, "=")[1] == truestr {
-				computePings = true
-			} else {
-				computePings = false
-			}
-		}
-		if strings.Contains(l, "mode") {
-			mode = strings.Split(l, "=")[1]
-		}
-		if strings.Contains(l, "cruxified") {
-			if strings.Split(l, "=")[1] == truestr {
-				cruxified = true
-			} else {
-				cruxified = false
-			}
+		kv := strings.SplitN(strings.TrimSpace(l), "=", 2)
+		if len(kv) != 2 {
+			continue
 		}
-		if strings.Contains(l, "remote") {
-			if strings.Split(l, "=")[1] == truestr {
-				remote = true
-			} else {
-				remote = false
-			}
+		if err := parseParam(kv[0], kv[1]); err != nil {
+			panic(err)
 		}
-		if strings.Contains(l, "ops") {
-			nOps, err = strconv.Atoi(strings.Split(l, "=")[1])
-			if err != nil {
-				panic(err)
-			}
+	}
+}
+
+// parseParam sets the simulation parameter with the given key, unknown keys
+// are ignored
+func parseParam(key, value string) error {
+	var err error
+	truestr := "true"
+	switch key {
+	case "pings":
+		computePings = value == truestr
+	case "mode":
+		mode = value
+	case "cruxified":
+		cruxified = value == truestr
+	case "remote":
+		remote = value == truestr
+	case "sharedipfs":
+		sharedIPFS = value == truestr
+	case "privateipfs":
+		privateIPFS = value == truestr
+	case "routing":
+		ipfsRouting = value
+	case "replmin":
+		replMin, err = strconv.Atoi(value)
+	case "replmax":
+		replMax, err = strconv.Atoi(value)
+	case "alloc":
+		allocator = value
+	case "pintracker":
+		pinTracker = value
+	case "family":
+		addrFamily = value
+	case "transport":
+		swarmTransport = value
+	case "routed":
+		routedOps = value == truestr
+	case "subnet":
+		bindSubnet = value
+	case "concurrency":
+		concurrency, err = strconv.Atoi(value)
+	case "ops":
+		nOps, err = strconv.Atoi(value)
+	default:
+		switch {
+		case strings.HasPrefix(key, "workload"):
+			err = parseWorkloadParam(key, value)
+		case strings.HasPrefix(key, "retry"):
+			err = parseRetryParam(key, value)
+		case strings.HasPrefix(key, "content"), key == "chunker",
+			key == "rawleaves":
+			err = parseContentParam(key, value)
 		}
 	}
+	return err
+}
+
+// parseWorkloadParam sets a parameter of the workload run by the simulation
+func parseWorkloadParam(key, value string) error {
+	var err error
+	c := &workloadConfig
+	switch key {
+	case "workload":
+		workload = value
+	case "workloadobjects":
+		c.Objects, err = strconv.Atoi(value)
+	case "workloadpopularity":
+		c.Popularity = value
+	case "workloadzipf":
+		c.ZipfS, err = strconv.ParseFloat(value, 64)
+	case "workloadreadratio":
+		c.ReadRatio, err = strconv.ParseFloat(value, 64)
+	case "workloadreaders":
+		c.Readers, err = strconv.Atoi(value)
+	case "workloadrate":
+		c.Rate, err = strconv.ParseFloat(value, 64)
+	case "workloadclients":
+		c.Clients, err = strconv.Atoi(value)
+	case "workloadseed":
+		c.Seed, err = strconv.ParseInt(value, 10, 64)
+	case "workloadreplication":
+		c.Replication = value == "true"
+	case "workloadreplicationtimeout":
+		c.ReplicationTimeout, err = time.ParseDuration(value)
+	case "workloadgateway":
+		c.Gateway = value == "true"
+	}
+	return err
+}
+
+// parseRetryParam sets the deadline and retries of the cluster operations
+func parseRetryParam(key, value string) error {
+	var err error
+	p := &retryPolicy
+	switch key {
+	case "retrytimeout":
+		p.Timeout, err = time.ParseDuration(value)
+	case "retryattempts":
+		p.Attempts, err = strconv.Atoi(value)
+	case "retrybackoff":
+		p.Backoff, err = time.ParseDuration(value)
+	}
+	return err
+}
+
+// parseContentParam sets a parameter of the files written by the tests
+func parseContentParam(key, value string) error {
+	var err error
+	c := &contentConfig
+	switch key {
+	case "contentdist":
+		c.SizeDist = value
+	case "contentsize":
+		c.Size, err = strconv.ParseInt(value, 10, 64)
+	case "contentmin":
+		c.MinSize, err = strconv.ParseInt(value, 10, 64)
+	case "contentmax":
+		c.MaxSize, err = strconv.ParseInt(value, 10, 64)
+	case "contentsigma":
+		c.Sigma, err = strconv.ParseFloat(value, 64)
+	case "contenttrace":
+		c.TraceFile = value
+	case "contenttype":
+		c.Content = value
+	case "contentfiles":
+		c.Files, err = strconv.Atoi(value)
+	case "contentseed":
+		c.Seed, err = strconv.ParseInt(value, 10, 64)
+	case "chunker":
+		c.Chunker = value
+	case "rawleaves":
+		c.RawLeaves = value == "true"
+	}
+	return err
 }
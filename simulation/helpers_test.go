@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/student_19_cruxIPFS/operations"
+)
+
+func TestParseWorkloadParam(t *testing.T) {
+	defer func(w string, c operations.WorkloadConfig) {
+		workload, workloadConfig = w, c
+	}(workload, workloadConfig)
+
+	for key, value := range map[string]string{
+		"workload":                   "custom",
+		"workloadobjects":            "50",
+		"workloadpopularity":         "zipf",
+		"workloadzipf":               "1.5",
+		"workloadreadratio":          "0.9",
+		"workloadreaders":            "3",
+		"workloadrate":               "2",
+		"workloadclients":            "4",
+		"workloadseed":               "42",
+		"workloadreplication":        "true",
+		"workloadreplicationtimeout": "30s",
+		"workloadgateway":            "true",
+	} {
+		if err := parseWorkloadParam(key, value); err != nil {
+			t.Fatal(key, err)
+		}
+	}
+	c := workloadConfig
+	if workload != "custom" || c.Objects != 50 || c.Popularity != "zipf" ||
+		c.ZipfS != 1.5 || c.ReadRatio != 0.9 || c.Readers != 3 ||
+		c.Rate != 2 || c.Clients != 4 || c.Seed != 42 || !c.Replication ||
+		c.ReplicationTimeout != 30*time.Second || !c.Gateway {
+		t.Fatal("wrong workload", workload, c)
+	}
+
+	for key, value := range map[string]string{
+		"workloadobjects":            "many",
+		"workloadzipf":               "",
+		"workloadreplicationtimeout": "30",
+	} {
+		if err := parseWorkloadParam(key, value); err == nil {
+			t.Fatal("no error for", key+"="+value)
+		}
+	}
+}
+
+func TestParseParam(t *testing.T) {
+	defer func(m string, n int, c operations.ContentConfig) {
+		mode, nOps, contentConfig = m, n, c
+	}(mode, nOps, contentConfig)
+
+	// keys are matched exactly, values may contain other keys
+	for _, kv := range [][2]string{
+		{"mode", "crdt"},
+		{"ops", "10"},
+		{"contenttrace", "traces/ops-mode-alloc-subnet-pings.txt"},
+		{"unknown", "ops"},
+	} {
+		if err := parseParam(kv[0], kv[1]); err != nil {
+			t.Fatal(kv[0], err)
+		}
+	}
+	if mode != "crdt" || nOps != 10 ||
+		contentConfig.TraceFile != "traces/ops-mode-alloc-subnet-pings.txt" {
+		t.Fatal("wrong parameters", mode, nOps, contentConfig.TraceFile)
+	}
+	if err := parseParam("ops", "ten"); err == nil {
+		t.Fatal("no error for ops=ten")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/simul"
+	"go.dedis.ch/onet/v3/simul/monitor"
 )
 
 func init() {
@@ -67,9 +68,10 @@ func (s *IPFSSimulation) Node(config *onet.SimulationConfig) error {
 
 	parseParams()
 
-	mymap := s.initializeMaps(config, true)
+	mymap := s.initializeMaps(config, !remote)
 
 	myService := config.GetService(service.ServiceName).(*service.Service)
+	myService.SetCounter(config.Server)
 
 	serviceReq := &service.InitRequest{
 		Nodes:                s.Nodes.All,
@@ -79,6 +81,22 @@ func (s *IPFSSimulation) Node(config *onet.SimulationConfig) error {
 		Cruxified:            cruxified,
 		ComputePings:         computePings,
 		Mode:                 mode,
+		ReplMin:              replMin,
+		ReplMax:              replMax,
+		Allocator:            allocator,
+		PinTracker:           pinTracker,
+		SharedIPFS:           sharedIPFS,
+		PrivateIPFS:          privateIPFS,
+		IPFSRouting:          ipfsRouting,
+		MaxConcurrentStarts:  concurrency,
+		AddrFamily:           addrFamily,
+		SwarmTransport:       swarmTransport,
+		BindSubnet:           bindSubnet,
+		// crashed instances are relaunched as the operations are retried
+		Relaunch: service.RelaunchPolicy{
+			Attempts: retryPolicy.Attempts,
+			Backoff:  retryPolicy.Backoff,
+		},
 	}
 
 	myService.InitRequest(serviceReq)
@@ -140,6 +158,9 @@ func (s *IPFSSimulation) Run(config *onet.SimulationConfig) error {
 			pi.(*service.StartIPFSProtocol).Nodes)
 	*/
 
+	startup := monitor.NewTimeMeasure("startup")
+	startupBw := monitor.NewCounterIOMeasure("startup_bandwidth", config.Server)
+
 	pi, err := myService.CreateProtocol(service.StartInstancesName, config.Tree)
 	if err != nil {
 		fmt.Println(err)
@@ -147,14 +168,87 @@ func (s *IPFSSimulation) Run(config *onet.SimulationConfig) error {
 	pi.Start()
 
 	<-pi.(*service.StartInstancesProtocol).Ready
+	startupBw.Record()
+	startup.Record()
 
-	operations.SaveState(cruxIPFS.SaveFile,
+	err = operations.SaveState(cruxIPFS.SaveFile,
 		pi.(*service.StartInstancesProtocol).Nodes)
+	if err != nil {
+		log.Error(err)
+	}
+
+	// wait for the clusters to converge
+	formation := monitor.NewTimeMeasure("ara_formation")
+	if !waitHealthy(myService, config.Tree) {
+		log.Lvl1("Not all ARAs formed after", healthTimeout,
+			"running operations anyway")
+	}
+	formation.Record()
+
+	content, err := operations.NewContentGenerator(contentConfig)
+	if err != nil {
+		return err
+	}
+	operations.SetContent(content)
+	operations.SetRetryPolicy(retryPolicy)
+	switch {
+	case workload == "custom":
+		cfg := workloadConfig
+		cfg.Nodes = len(myService.Nodes.All)
+		cfg.Ops = nOps
+		if cfg.Objects == 0 {
+			cfg.Objects = nOps
+		}
+		cfg.Routed = routedOps
+		operations.RunWorkload(cfg)
+	default:
+		// Test2, or Test3 if routed
+		cfg := operations.Test2Workload(nOps, len(myService.Nodes.All))
+		cfg.Routed = routedOps
+		cfg.Replication = workloadConfig.Replication
+		cfg.ReplicationTimeout = workloadConfig.ReplicationTimeout
+		cfg.Gateway = workloadConfig.Gateway
+		operations.RunWorkload(cfg)
+	}
+
+	// stop all instances and remove their repos for the next run
+	pi, err = myService.CreateProtocol(service.StopInstancesName, config.Tree)
+	if err != nil {
+		fmt.Println(err)
+	}
+	pi.(*service.StopInstancesProtocol).Clean = true
+	pi.Start()
 
-	// wait for some time for clusters to converge
-	time.Sleep(3 * time.Minute)
-	operations.Test2(nOps, len(myService.Nodes.All))
+	<-pi.(*service.StopInstancesProtocol).Ready
 
 	log.Lvl1("Done")
 	return nil
 }
+
+// waitHealthy runs the Health protocol until all ARAs are formed or until
+// healthTimeout, and returns true if all ARAs are formed
+func waitHealthy(myService *service.Service, tree *onet.Tree) bool {
+	deadline := time.Now().Add(healthTimeout)
+	for {
+		pi, err := myService.CreateProtocol(service.HealthName, tree)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		// a round never outlasts the deadline, even if a node is down
+		pi.(*service.HealthProtocol).Timeout = time.Until(deadline)
+		if pi.(*service.HealthProtocol).Timeout < healthInterval {
+			pi.(*service.HealthProtocol).Timeout = healthInterval
+		}
+		pi.Start()
+		<-pi.(*service.HealthProtocol).Ready
+
+		if pi.(*service.HealthProtocol).Healthy {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(healthInterval)
+	}
+}